@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/storage"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func (app *application) listTaskAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	attachments, err := app.models.Attachments.GetAllForTask(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) uploadTaskAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	v := validator.New()
+
+	// Work out how large the file is allowed to be, which is the smaller of the per-file
+	// limit and whatever is left of the user's quota. Two uploads running at the same
+	// time can take a user slightly over their quota, which we accept.
+	limit := app.config.attachments.maxFileSize
+	if app.config.attachments.maxUserSize > 0 {
+		used, err := app.models.Attachments.TotalSizeForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		remaining := app.config.attachments.maxUserSize - used
+		if remaining <= 0 {
+			v.AddError("file", "you have used all of your attachment storage")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		limit = min(limit, remaining)
+	}
+
+	// Uploads can take much longer than the server's read timeout allows for, so extend
+	// the deadline for this request.
+	err = http.NewResponseController(w).SetReadDeadline(time.Now().Add(app.config.attachments.timeout))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Leave some room on top of the file itself for the multipart headers and boundaries.
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1_048_576)
+	part, err := app.readMultipartFile(r, "file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer part.Close()
+
+	// Trust the content type sent by the client unless it's missing or generic, in which
+	// case we sniff it from the first 512 bytes of the file instead.
+	body := bufio.NewReaderSize(part, 512)
+	contentType := part.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		head, _ := body.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		v.AddError("file", "must have a valid content type")
+	}
+	attachment := &data.Attachment{
+		TaskID:      id,
+		UserID:      user.ID,
+		Filename:    filepath.Base(filepath.Clean("/" + part.FileName())),
+		ContentType: contentType,
+	}
+	if data.ValidateAttachment(v, attachment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Stream the file into storage, hashing it on the way. We read at most one byte more
+	// than the limit, which is enough to tell whether the file is too large.
+	attachment.StorageKey, err = storage.NewKey()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hash := sha256.New()
+	attachment.Size, err = app.storage.Put(r.Context(), attachment.StorageKey, io.TeeReader(io.LimitReader(body, limit+1), hash))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if attachment.Size > limit {
+		app.deleteStoredFile(r, attachment.StorageKey)
+		if limit == app.config.attachments.maxFileSize {
+			v.AddError("file", fmt.Sprintf("must not be larger than %d bytes", limit))
+		} else {
+			v.AddError("file", fmt.Sprintf("would exceed your attachment storage; %d bytes are left", limit))
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	err = app.models.Attachments.Insert(attachment)
+	if err != nil {
+		app.deleteStoredFile(r, attachment.StorageKey)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d/attachments/%d", id, attachment.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTaskAttachment fetches the attachment named in the URL, sending a 404 Not Found
+// response and returning nil if it doesn't exist on the task.
+func (app *application) readTaskAttachment(w http.ResponseWriter, r *http.Request) *data.Attachment {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	attachmentID, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	attachment, err := app.models.Attachments.Get(attachmentID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return attachment
+}
+
+func (app *application) showTaskAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := app.readTaskAttachment(w, r)
+	if attachment == nil {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"attachment": attachment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) downloadTaskAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := app.readTaskAttachment(w, r)
+	if attachment == nil {
+		return
+	}
+	file, err := app.storage.Open(r.Context(), attachment.StorageKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(app.config.attachments.timeout))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Always send the file as a download, and stop browsers from second-guessing the
+	// content type, so that an uploaded HTML file can't be rendered on our origin.
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.SHA256+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Once the headers have been sent there's no way to report an error to the client,
+	// so all we can do is log it.
+	_, err = io.Copy(w, file)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) deleteTaskAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := app.readTaskAttachment(w, r)
+	if attachment == nil {
+		return
+	}
+	err := app.models.Attachments.Delete(attachment.ID, attachment.TaskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.deleteStoredFile(r, attachment.StorageKey)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteStoredFile removes a file from storage. Failing to do so only leaves an orphaned
+// file behind, so the error is logged rather than sent to the client.
+func (app *application) deleteStoredFile(r *http.Request, key string) {
+	err := app.storage.Delete(r.Context(), key)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+	"time"
+)
+
+// maxBatchOperations is the largest number of operations accepted in a single batch.
+const maxBatchOperations = 500
+
+// batchOperation is a single operation in a batch request. Task holds the same fields as
+// the body of POST /v1/tasks for a create, or of PATCH /v1/tasks/:id for an update.
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Cascade bool            `json:"cascade"`
+	Task    json.RawMessage `json:"task"`
+}
+
+// batchResult reports the outcome of a single operation, using the HTTP status code that
+// the operation would have got as a request of its own.
+type batchResult struct {
+	Index          int         `json:"index"`
+	Op             string      `json:"op"`
+	Status         int         `json:"status"`
+	Task           *data.Task  `json:"task,omitempty"`
+	NextOccurrence *data.Task  `json:"next_occurrence,omitempty"`
+	Error          interface{} `json:"error,omitempty"`
+}
+
+// The batchTasksHandler runs a list of create, update and delete operations in a single
+// request. By default every operation is attempted and committed on its own, and the
+// response reports the outcome of each. With atomic=true they all run in one transaction,
+// which is rolled back as soon as one of them fails. The operations before the failed one
+// are then reported with a 424 Failed Dependency status, as none of them were applied.
+func (app *application) batchTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Operations []batchOperation `json:"operations"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	atomic := app.readBool(r.URL.Query(), "atomic", false, v)
+	v.Check(len(input.Operations) > 0, "operations", "must be provided")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	models := app.models
+	if atomic {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		tx, err := app.models.Tasks.DB.BeginTx(ctx, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		defer tx.Rollback()
+		models = models.WithTx(tx)
+
+		results := make([]batchResult, 0, len(input.Operations))
+		for i, op := range input.Operations {
+			result := app.runBatchOperation(r, models, i, op)
+			results = append(results, result)
+			if result.Status >= 400 {
+				// Nothing has been saved, so respond with the status of the failed
+				// operation and the results up to and including it. The earlier
+				// operations only succeeded in the transaction which is being rolled
+				// back, so their results are replaced, and the tasks they returned,
+				// which were never saved, are left out.
+				message := fmt.Sprintf("operation %d failed, so none of the operations were applied", i)
+				for j := range results[:i] {
+					results[j] = batchResult{
+						Index:  j,
+						Op:     results[j].Op,
+						Status: http.StatusFailedDependency,
+						Error:  fmt.Sprintf("not applied, because operation %d failed", i),
+					}
+				}
+				err = app.writeJSON(w, result.Status, envelope{"error": message, "results": results}, nil)
+				if err != nil {
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	results := make([]batchResult, len(input.Operations))
+	for i, op := range input.Operations {
+		results[i] = app.runBatchOperation(r, models, i, op)
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runBatchOperation carries out a single operation of a batch. It goes through the same
+// checks as the equivalent single-task request, including the role that the user holds on
+// the task.
+func (app *application) runBatchOperation(r *http.Request, models data.Models, index int, op batchOperation) batchResult {
+	user := app.contextGetUser(r)
+	result := batchResult{Index: index, Op: op.Op}
+	var err error
+	switch op.Op {
+	case "create":
+		var input createTaskInput
+		if err = decodeBatchTask(op.Task, &input); err != nil {
+			break
+		}
+		result.Task, err = app.createTask(models, user, input)
+		result.Status = http.StatusCreated
+	case "update":
+		var input updateTaskInput
+		if err = decodeBatchTask(op.Task, &input); err != nil {
+			break
+		}
+		if err = app.checkTaskRole(models.Tasks, op.ID, user.ID, data.RoleEditor); err != nil {
+			break
+		}
+		result.Task, result.NextOccurrence, err = app.updateTask(models, user, op.ID, input)
+		result.Status = http.StatusOK
+	case "delete":
+		if err = app.checkTaskRole(models.Tasks, op.ID, user.ID, data.RoleOwner); err != nil {
+			break
+		}
+		err = app.deleteTask(models.Tasks, user, op.ID, op.Cascade)
+		result.Status = http.StatusOK
+	default:
+		err = errBadBatchOperation{errors.New(`op must be one of "create", "update" or "delete"`)}
+	}
+	if err != nil {
+		result.Task, result.NextOccurrence = nil, nil
+		result.Status, result.Error = app.batchError(r, err)
+	}
+	return result
+}
+
+// errBadBatchOperation wraps the errors for an operation which can't be understood at
+// all, which are reported with a 400 Bad Request status.
+type errBadBatchOperation struct {
+	err error
+}
+
+func (e errBadBatchOperation) Error() string {
+	return e.err.Error()
+}
+
+// decodeBatchTask decodes the task fields of an operation in the same strict way as
+// readJSON(), so that unknown fields are rejected.
+func decodeBatchTask(raw json.RawMessage, dst interface{}) error {
+	if len(raw) == 0 {
+		return errBadBatchOperation{errors.New("task must be provided")}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err != nil {
+		return errBadBatchOperation{fmt.Errorf("task contains invalid JSON: %w", err)}
+	}
+	return nil
+}
+
+// checkTaskRole does the job of requireTaskPermission() for a single operation of a batch.
+// The batch endpoint itself requires the tasks:write permission, so only the role needs
+// checking here.
+func (app *application) checkTaskRole(tasks data.TaskModel, id, userID int64, role string) error {
+	taskRole, _, err := tasks.GetRole(id, userID)
+	if err != nil {
+		return err
+	}
+	if !data.RoleIncludes(taskRole, role) {
+		return errNotPermitted
+	}
+	return nil
+}
+
+// errNotPermitted is returned when the user doesn't hold the role needed for an operation.
+var errNotPermitted = errors.New("your user account doesn't have the necessary permissions to access this resource")
+
+// batchError turns an error from an operation into the status code and error message that
+// taskErrorResponse() would have sent for it. Server errors are logged, and only a generic
+// message is returned to the client.
+func (app *application) batchError(r *http.Request, err error) (int, interface{}) {
+	var (
+		validationError failedValidationError
+		badOperation    errBadBatchOperation
+	)
+	switch {
+	case errors.As(err, &badOperation):
+		return http.StatusBadRequest, badOperation.Error()
+	case errors.As(err, &validationError):
+		return http.StatusUnprocessableEntity, validationError.errors
+	case errors.Is(err, data.ErrRecordNotFound):
+		return http.StatusNotFound, "the requested resource could not be found"
+	case errors.Is(err, data.ErrEditConflict):
+		return http.StatusConflict, "unable to update the record due to an edit conflict, please try again"
+	case errors.Is(err, errNotPermitted):
+		return http.StatusForbidden, err.Error()
+	default:
+		app.logError(r, err)
+		return http.StatusInternalServerError, "the server encountered a problem and could not process your request"
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/ical"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// calendarFeedTTL is how long a calendar feed URL stays valid. Calendar applications
+// keep polling the same URL for as long as the subscription exists, so it is long, and
+// users revoke the URL rather than waiting for it to expire.
+const calendarFeedTTL = 10 * 365 * 24 * time.Hour
+
+// maxCalendarFeedTasks caps the number of tasks in a calendar feed.
+const maxCalendarFeedTasks = 5000
+
+// maxICalImportSize is the largest iCalendar file accepted by the import, and
+// maxICalImportTasks is the largest number of to-dos and events that it can hold.
+const (
+	maxICalImportSize  = 5 << 20
+	maxICalImportTasks = 1000
+)
+
+// icalImportCategory is the category given to imported to-dos which have none, as every
+// task needs one.
+const icalImportCategory = "imported"
+
+// The createCalendarFeedHandler issues a new secret URL for the user's calendar feed.
+// Any URL that was issued before stops working, so this is also how a user regenerates
+// the URL if it has leaked. The URL can't be shown again later, as only a hash of the
+// token in it is stored.
+func (app *application) createCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeCalendar, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.models.Tokens.New(user.ID, calendarFeedTTL, data.ScopeCalendar)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	feed := map[string]interface{}{
+		"url":    app.baseURL(r) + "/v1/calendar/" + token.Plaintext + "/tasks.ics",
+		"expiry": token.Expiry,
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"calendar_feed": feed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revokeCalendarFeedHandler stops the user's calendar feed URL from working.
+func (app *application) revokeCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeCalendar, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "calendar feed successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showCalendarFeedHandler serves the calendar feed of the user that the token in the
+// URL belongs to, as an iCalendar document with a VTODO for each task that they can see.
+// Calendar applications can't send an Authorization header, so the token in the URL is
+// all that authenticates the request. Unknown tokens get a 404 Not Found, so that the
+// response doesn't tell anybody guessing tokens any more than that.
+func (app *application) showCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeCalendar, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The user must still be allowed to read tasks, just as requirePermission() checks
+	// for the rest of the API.
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !user.Activated || !permissions.Include("tasks:read") {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Read the tasks a page at a time, by ID so that tasks changing while we read them
+	// can't be skipped or repeated.
+	cal := &ical.Calendar{ProdID: "-//TaskNinja//TaskNinja " + version + "//EN", Name: "TaskNinja"}
+	now := time.Now()
+	var q data.TaskQuery
+	filters := data.Filters{PageSize: 500, Sort: "id", SortSafelist: []string{"id"}, UseCursor: true}
+	for len(cal.Todos) < maxCalendarFeedTasks {
+		tasks, metadata, err := app.models.Tasks.GetAll(q, user.ID, filters)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for _, task := range tasks {
+			cal.Todos = append(cal.Todos, taskTodo(task, now))
+		}
+		if metadata.NextCursor == "" {
+			break
+		}
+		filters.Cursor = metadata.NextCursor
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	err = ical.Encode(w, cal)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// icalImportResult reports what was done with a single to-do from an imported file, using
+// the HTTP status code that creating or updating the task on its own would have got.
+type icalImportResult struct {
+	Index  int         `json:"index"`
+	UID    string      `json:"uid,omitempty"`
+	Action string      `json:"action,omitempty"`
+	Status int         `json:"status"`
+	Task   *data.Task  `json:"task,omitempty"`
+	Error  interface{} `json:"error,omitempty"`
+}
+
+// The importICalHandler creates tasks from the to-dos (VTODO components) in an iCalendar
+// file, which is either uploaded in the "file" field of a multipart/form-data body or
+// sent as the body itself. Events (VEVENT components) are imported as to-dos which are
+// due when the event ends. Each to-do is imported on its own, and the response reports
+// the outcome of each in the same way as the batch endpoint. A to-do that was imported
+// before, going by its UID, updates the task it was imported as instead of creating
+// another one, and so does a to-do from our own calendar feed.
+func (app *application) importICalHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxICalImportSize)
+	file, err := app.readUploadedFile(r, "file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	v := validator.New()
+	cal, err := ical.Decode(file)
+	if err != nil {
+		var (
+			syntaxError   *ical.SyntaxError
+			maxBytesError *http.MaxBytesError
+		)
+		switch {
+		case errors.As(err, &syntaxError):
+			v.AddError("file", "must be a valid iCalendar file: "+syntaxError.Error())
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	v.Check(len(cal.Todos) > 0, "file", "must contain at least one VTODO or VEVENT")
+	v.Check(len(cal.Todos) <= maxICalImportTasks, "file", fmt.Sprintf("must not contain more than %d VTODOs and VEVENTs", maxICalImportTasks))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	results := make([]icalImportResult, 0, len(cal.Todos))
+	counts := map[string]int{"created": 0, "updated": 0, "failed": 0}
+	for i, todo := range cal.Todos {
+		result := icalImportResult{Index: i, UID: todo.UID}
+		task, created, err := app.importTodo(user, todo)
+		switch {
+		case err != nil:
+			result.Action = "failed"
+			result.Status, result.Error = app.batchError(r, err)
+		case created:
+			result.Action, result.Status, result.Task = "created", http.StatusCreated, task
+		default:
+			result.Action, result.Status, result.Task = "updated", http.StatusOK, task
+		}
+		counts[result.Action]++
+		results = append(results, result)
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results, "summary": counts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importTodo creates a task for a to-do on behalf of the user, or updates the task that it
+// was imported as before, reporting which of the two it did. The fields are checked by
+// createTask() and updateTask() in the same way as they are for the rest of the API.
+func (app *application) importTodo(user *data.User, todo ical.Todo) (*data.Task, bool, error) {
+	id, err := app.importedTaskID(user, todo.UID)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		var task *data.Task
+		task, err = app.createTask(app.models, user, todoTaskInput(todo))
+		if !errors.Is(err, data.ErrDuplicateICalUID) {
+			return task, true, err
+		}
+		// Another request imported the same to-do since we looked, so update the task
+		// that it created instead.
+		id, err = app.importedTaskID(user, todo.UID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	task, err := app.models.Tasks.Get(id, user.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	// Only the fields which differ are changed, so that the history of the task only
+	// records real changes, and the fields which the to-do leaves out are kept.
+	input := updateTaskInput{Version: &task.Version}
+	if todo.Summary != task.Title {
+		input.Title = &todo.Summary
+	}
+	if todo.Description != "" && todo.Description != task.Description {
+		input.Description = &todo.Description
+	}
+	if !todo.Due.IsZero() && !todo.Due.Equal(time.Time(task.DueDate)) {
+		due := data.CustomTime(todo.Due)
+		input.DueDate = &due
+	}
+	if priority := taskPriority(todo.Priority); priority != "" && priority != task.Priority {
+		input.Priority = &priority
+	}
+	if status := taskStatus(todo); status != "" && status != task.Status {
+		input.Status = &status
+	}
+	if len(todo.Categories) > 0 {
+		if todo.Categories[0] != task.Category {
+			input.Category = &todo.Categories[0]
+		}
+		if tags := data.NormalizeTags(todo.Categories[1:]); !slices.Equal(tags, task.Tags) {
+			input.Tags = &tags
+		}
+	}
+	if todo.RRule != task.Recurrence {
+		input.Recurrence = &todo.RRule
+	}
+	task, _, err = app.updateTask(app.models, user, id, input)
+	return task, false, err
+}
+
+// importedTaskID returns the ID of the task that the to-do with the given UID was
+// imported as, or ErrRecordNotFound if it is a new to-do. A UID from our own calendar
+// feed refers to the task it was made for, provided that the user can edit it.
+func (app *application) importedTaskID(user *data.User, uid string) (int64, error) {
+	if uid == "" {
+		return 0, data.ErrRecordNotFound
+	}
+	if id, ok := parseTaskUID(uid); ok {
+		err := app.checkTaskRole(app.models.Tasks, id, user.ID, data.RoleEditor)
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			return id, err
+		}
+		// The task doesn't exist, or isn't one that the user can see, so the to-do came
+		// from somebody else's feed and is treated like any other.
+	}
+	return app.models.Tasks.GetIDByICalUID(uid, user.ID)
+}
+
+// todoTaskInput returns the input for creating a task from a to-do. To-dos don't need a
+// description, but tasks do, so the summary is used when there isn't one.
+func todoTaskInput(todo ical.Todo) createTaskInput {
+	input := createTaskInput{
+		Title:       todo.Summary,
+		Description: todo.Description,
+		DueDate:     data.CustomTime(todo.Due),
+		Priority:    taskPriority(todo.Priority),
+		Status:      taskStatus(todo),
+		Category:    icalImportCategory,
+		Recurrence:  todo.RRule,
+		ICalUID:     todo.UID,
+	}
+	if input.Description == "" {
+		input.Description = todo.Summary
+	}
+	if input.Priority == "" {
+		input.Priority = "medium"
+	}
+	if input.Status == "" {
+		input.Status = data.StatusTodo
+	}
+	// The first category becomes the category of the task and the rest become its tags,
+	// which is the reverse of what taskTodo() does.
+	if len(todo.Categories) > 0 {
+		input.Category = todo.Categories[0]
+		input.Tags = todo.Categories[1:]
+	}
+	return input
+}
+
+// taskPriority maps the PRIORITY property onto the priority of a task, using the bands
+// that RFC 5545 gives for high (1-4), medium (5) and low (6-9). An undefined priority
+// gives an empty string.
+func taskPriority(priority int) string {
+	switch {
+	case priority >= 1 && priority <= 4:
+		return "high"
+	case priority == 5:
+		return "medium"
+	case priority >= 6 && priority <= 9:
+		return "low"
+	default:
+		return ""
+	}
+}
+
+// taskStatus maps the STATUS property of a to-do onto the status of a task. A cancelled
+// to-do won't be worked on any more, so it is treated as completed, as is a to-do with a
+// completion time but no status. Otherwise an unknown status gives an empty string.
+func taskStatus(todo ical.Todo) string {
+	switch todo.Status {
+	case ical.StatusNeedsAction:
+		return data.StatusTodo
+	case ical.StatusInProcess:
+		return data.StatusInProgress
+	case ical.StatusCompleted, ical.StatusCancelled:
+		return data.StatusCompleted
+	}
+	if todo.Status == "" && !todo.Completed.IsZero() {
+		return data.StatusCompleted
+	}
+	return ""
+}
+
+// taskTodo returns the VTODO for a task.
+func taskTodo(task *data.Task, now time.Time) ical.Todo {
+	todo := ical.Todo{
+		UID:          taskUID(task),
+		Stamp:        now,
+		Created:      time.Time(task.CreatedAt),
+		LastModified: time.Time(task.UpdatedAt),
+		Summary:      task.Title,
+		Description:  task.Description,
+		Due:          time.Time(task.DueDate),
+		Priority:     icalPriority(task.Priority),
+		Status:       icalStatus(task.Status),
+		RRule:        task.Recurrence,
+	}
+	if task.CompletedAt != nil {
+		todo.Completed = time.Time(*task.CompletedAt)
+	}
+	// Calendar applications have no separate idea of tags, so they're listed as
+	// categories after the category of the task.
+	todo.Categories = append([]string{task.Category}, task.Tags...)
+	return todo
+}
+
+// taskUID returns the UID of the VTODO for a task. Tasks which were imported keep the UID
+// of the to-do they were imported from, so that calendar applications don't see them as
+// new to-dos.
+func taskUID(task *data.Task) string {
+	if task.ICalUID != "" {
+		return task.ICalUID
+	}
+	return fmt.Sprintf("task-%d@taskninja", task.ID)
+}
+
+// parseTaskUID returns the ID of the task that a UID made by taskUID() refers to.
+func parseTaskUID(uid string) (int64, bool) {
+	s, ok := strings.CutPrefix(uid, "task-")
+	if !ok {
+		return 0, false
+	}
+	s, ok = strings.CutSuffix(s, "@taskninja")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+	return id, true
+}
+
+// icalPriority maps the priority of a task onto the scale of the PRIORITY property, using
+// the values which calendar applications show as high, medium and low.
+func icalPriority(priority string) int {
+	switch priority {
+	case "high":
+		return 1
+	case "medium":
+		return 5
+	case "low":
+		return 9
+	default:
+		return 0
+	}
+}
+
+// icalStatus maps the status of a task onto the STATUS property.
+func icalStatus(status string) string {
+	switch status {
+	case data.StatusInProgress:
+		return ical.StatusInProcess
+	case data.StatusCompleted:
+		return ical.StatusCompleted
+	default:
+		return ical.StatusNeedsAction
+	}
+}
+
+// The baseURL() helper returns the URL that the client reached the API at, for building
+// links which are used outside of the API, such as in calendar applications. The
+// base-url setting takes precedence over the request.
+func (app *application) baseURL(r *http.Request) string {
+	if app.config.baseURL != "" {
+		return strings.TrimSuffix(app.config.baseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+)
+
+func (app *application) listTaskCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	collaborators, err := app.models.Collaborators.GetAllForTask(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"collaborators": collaborators}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addTaskCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Collaborators are added by email address, so that the caller doesn't need to know
+	// the internal ID of the user they are sharing the task with.
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	collaborator := &data.Collaborator{
+		TaskID: id,
+		Role:   input.Role,
+	}
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	if data.ValidateCollaborator(v, collaborator); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The owner of a task always holds the owner role on it, so there's nothing to add.
+	task, err := app.models.Tasks.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if task.UserID == user.ID {
+		v.AddError("email", "this user already owns the task")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	collaborator.UserID = user.ID
+	collaborator.Name = user.Name
+	collaborator.Email = user.Email
+	err = app.models.Collaborators.Insert(collaborator)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"collaborator": collaborator}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeTaskCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Anybody with the owner role can remove a collaborator, and every collaborator is
+	// allowed to remove themselves from a task that was shared with them.
+	user := app.contextGetUser(r)
+	if userID != user.ID {
+		role, _, err := app.models.Tasks.GetRole(id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.RoleIncludes(role, data.RoleOwner) {
+			app.notPermittedResponses(w, r)
+			return
+		}
+	}
+	err = app.models.Collaborators.Delete(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "collaborator successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
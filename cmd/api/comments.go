@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+)
+
+func (app *application) listTaskCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "created_at")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only top-level comments are paginated; each one comes with all of its replies.
+	comments, metadata, err := app.models.Comments.GetAllForTask(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"comments": comments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createTaskCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// The author of the comment is always the authenticated user.
+	user := app.contextGetUser(r)
+	comment := &data.Comment{
+		TaskID:     id,
+		UserID:     user.ID,
+		AuthorName: user.Name,
+		ParentID:   input.ParentID,
+		Body:       input.Body,
+	}
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Replies are only one level deep, so the comment being replied to must be a
+	// top-level comment on the same task.
+	if comment.ParentID != nil {
+		parent, err := app.models.Comments.Get(*comment.ParentID, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("parent_id", "must refer to an existing comment on this task")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if parent.ParentID != nil {
+			v.AddError("parent_id", "must not refer to a reply")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+	err = app.models.Comments.Insert(comment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTaskComment fetches the comment named in the URL, sending a 404 Not Found response
+// and returning nil if it doesn't exist on the task.
+func (app *application) readTaskComment(w http.ResponseWriter, r *http.Request) *data.Comment {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	commentID, err := app.readNamedIDParam(r, "comment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	comment, err := app.models.Comments.Get(commentID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return comment
+}
+
+func (app *application) updateTaskCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := app.readTaskComment(w, r)
+	if comment == nil {
+		return
+	}
+	// Only the author of a comment can edit it.
+	if comment.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponses(w, r)
+		return
+	}
+	// The client can optionally send the version of the comment it was editing, so that
+	// changes made since it was fetched aren't overwritten.
+	var input struct {
+		Body    *string `json:"body"`
+		Version *int32  `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Version != nil && *input.Version != comment.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	if input.Body != nil {
+		comment.Body = *input.Body
+	}
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Comments.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTaskCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := app.readTaskComment(w, r)
+	if comment == nil {
+		return
+	}
+	// The author of a comment can delete it, and so can anybody with the owner role on
+	// the task, so that unwanted comments can be moderated.
+	user := app.contextGetUser(r)
+	if comment.UserID != user.ID {
+		role, _, err := app.models.Tasks.GetRole(comment.TaskID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.RoleIncludes(role, data.RoleOwner) {
+			app.notPermittedResponses(w, r)
+			return
+		}
+	}
+	err := app.models.Comments.Delete(comment.ID, comment.TaskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "comment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
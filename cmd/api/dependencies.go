@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+	"strings"
+)
+
+func (app *application) addTaskDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		BlockedBy int64 `json:"blocked_by"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.BlockedBy > 0, "blocked_by", "must be provided")
+	v.Check(input.BlockedBy != id, "blocked_by", "must not refer to the task itself")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// The user only needs to be able to see the blocking task, not edit it.
+	_, _, err = app.models.Tasks.GetRole(input.BlockedBy, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("blocked_by", "must refer to an existing task")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Dependencies.Insert(id, input.BlockedBy)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDependencyCycle):
+			v.AddError("blocked_by", "would create a dependency cycle")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	blockedBy, err := app.models.Dependencies.GetBlockedBy(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"blocked_by": blockedBy}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeTaskDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	blockedByID, err := app.readNamedIDParam(r, "blocked_by_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Dependencies.Delete(id, blockedByID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "dependency successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The validateTaskBlockers() helper records a validation error against the status field
+// if the task is being completed while any of the tasks it is blocked by are still open.
+// Blockers that the user can't see still count, but only their number is given.
+func (app *application) validateTaskBlockers(v *validator.Validator, tasks data.TaskModel, task *data.Task, userID int64) error {
+	visible, hidden, err := tasks.OpenBlockers(task.ID, userID)
+	if err != nil {
+		return err
+	}
+	var open []string
+	for _, id := range visible {
+		open = append(open, fmt.Sprintf("%d", id))
+	}
+	if hidden > 0 {
+		open = append(open, fmt.Sprintf("%d task(s) that you can't see", hidden))
+	}
+	if len(open) > 0 {
+		v.AddError("status", "cannot be completed while blocked by open tasks: "+strings.Join(open, ", "))
+	}
+	return nil
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 // The logError() method is a generic helper for logging an error message.
@@ -13,10 +16,23 @@ func (app *application) logError(r *http.Request, err error) {
 	// request method and URL as properties in the log entry.
 	app.logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
-		"request_url":    r.URL.String(),
+		"request_url":    redactedURL(r),
 	})
 }
 
+// redactedURL returns the URL of the request for the logs. The token in the URL of a
+// calendar feed is all that it takes to read the feed, so it's replaced with REDACTED.
+func redactedURL(r *http.Request) string {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	if token == "" {
+		return r.URL.String()
+	}
+	u := *r.URL
+	u.Path = strings.Replace(u.Path, token, "REDACTED", 1)
+	u.RawPath = ""
+	return u.String()
+}
+
 // The errorResponse() method is a generic helper for sending JSON-formatted error messages to the client with a given status code.
 // Note that we're using an interface{} type for the message parameter, rather than just a string type, as this gives us
 // more flexibility over the values that we can include in the response.
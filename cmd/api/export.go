@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportPageSize is the number of tasks read from the database at a time for an export.
+const exportPageSize = 500
+
+// exportPageTimeout is how long the client has to receive each page of an export. The
+// write deadline is pushed back after every page, so that large exports aren't cut off
+// by the server's write timeout.
+const exportPageTimeout = 30 * time.Second
+
+// exportTimeLayout is the layout of the times in a CSV export, which is the same as the
+// one used for times in JSON.
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// taskCSVColumns lists the columns of a CSV export, in order. Lists, such as the tags, are
+// written as comma-separated values in a single column.
+var taskCSVColumns = []string{"id", "title", "description", "due_date", "priority", "status", "category", "tags",
+	"parent_id", "project_id", "user_id", "recurrence", "reminders", "started_at", "completed_at", "created_at",
+	"updated_at", "version"}
+
+// The exportTasksHandler streams every task matching the same filters and sort as
+// GET /v1/tasks, as CSV (the default) or as newline-delimited JSON with one task per line
+// in the same form as the rest of the API. There's no limit on the number of tasks, so
+// they're read a page at a time by cursor and written out as they're read.
+func (app *application) exportTasksHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	format := app.readString(qs, "format", "csv")
+	v.Check(validator.In(format, "csv", "ndjson"), "format", "must be either csv or ndjson")
+
+	// The pagination parameters don't apply, as everything is exported.
+	qs.Del("page")
+	qs.Del("page_size")
+	qs.Del("cursor")
+	q, filters := app.readTaskListing(qs, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	filters.UseCursor = true
+	filters.PageSize = exportPageSize
+
+	// Read the first page before anything is written, so that an error can still be
+	// reported in the usual way.
+	tasks, metadata, err := app.models.Tasks.GetAll(q, user.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var tw taskWriter
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		tw = newCSVTaskWriter(w)
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		tw = newNDJSONTaskWriter(w)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tasks.%s"`, format))
+
+	// Once the response has started, an error can only be reported by cutting it off,
+	// so that the client doesn't mistake a partial export for a complete one.
+	rc := http.NewResponseController(w)
+	for {
+		for _, task := range tasks {
+			err = tw.Write(task)
+			if err != nil {
+				app.logError(r, err)
+				panic(http.ErrAbortHandler)
+			}
+		}
+		err = tw.Flush()
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			app.logError(r, err)
+			panic(http.ErrAbortHandler)
+		}
+		if metadata.NextCursor == "" {
+			return
+		}
+		err = rc.SetWriteDeadline(time.Now().Add(exportPageTimeout))
+		if err != nil {
+			app.logError(r, err)
+			panic(http.ErrAbortHandler)
+		}
+		filters.Cursor = metadata.NextCursor
+		tasks, metadata, err = app.models.Tasks.GetAll(q, user.ID, filters)
+		if err != nil {
+			app.logError(r, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// taskWriter writes tasks out in one of the export formats.
+type taskWriter interface {
+	Write(task *data.Task) error
+	// Flush writes out any tasks which are still buffered.
+	Flush() error
+}
+
+// csvTaskWriter writes tasks as CSV rows, after a header row naming the columns.
+type csvTaskWriter struct {
+	w *csv.Writer
+}
+
+func newCSVTaskWriter(w io.Writer) *csvTaskWriter {
+	cw := csv.NewWriter(w)
+	// The csv.Writer is buffered, so any error writing the header is returned by Flush().
+	_ = cw.Write(taskCSVColumns)
+	return &csvTaskWriter{w: cw}
+}
+
+func (tw *csvTaskWriter) Write(task *data.Task) error {
+	record := taskCSVRecord(task)
+	for i := range record {
+		record[i] = escapeCSVFormula(record[i])
+	}
+	return tw.w.Write(record)
+}
+
+func (tw *csvTaskWriter) Flush() error {
+	tw.w.Flush()
+	return tw.w.Error()
+}
+
+// taskCSVRecord returns the values of the columns in taskCSVColumns for a task. Fields
+// which aren't set are left empty.
+func taskCSVRecord(task *data.Task) []string {
+	optionalID := func(id *int64) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatInt(*id, 10)
+	}
+	optionalTime := func(t *data.CustomTime) string {
+		if t == nil {
+			return ""
+		}
+		return time.Time(*t).Format(exportTimeLayout)
+	}
+	return []string{
+		strconv.FormatInt(task.ID, 10),
+		task.Title,
+		task.Description,
+		time.Time(task.DueDate).Format(exportTimeLayout),
+		task.Priority,
+		task.Status,
+		task.Category,
+		strings.Join(task.Tags, ","),
+		optionalID(task.ParentID),
+		optionalID(task.ProjectID),
+		strconv.FormatInt(task.UserID, 10),
+		task.Recurrence,
+		strings.Join(task.Reminders.Strings(), ","),
+		optionalTime(task.StartedAt),
+		optionalTime(task.CompletedAt),
+		time.Time(task.CreatedAt).Format(exportTimeLayout),
+		time.Time(task.UpdatedAt).Format(exportTimeLayout),
+		strconv.FormatInt(int64(task.Version), 10),
+	}
+}
+
+// csvFormulaPrefixes are the characters which make a spreadsheet application treat the
+// contents of a cell as a formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVFormula stops a value from being run as a formula when the CSV file is opened
+// in a spreadsheet application, which would let anybody who can edit a task run code on
+// the machine of whoever exports it. A value starting with one of csvFormulaPrefixes gets
+// a leading "'", which spreadsheets show as text. So that unescapeCSVFormula() can tell
+// the "'" apart from one which was already there, values which already start with "'"
+// followed by one of csvFormulaPrefixes get another one.
+func escapeCSVFormula(value string) string {
+	if rest := strings.TrimLeft(value, "'"); rest != "" && strings.ContainsRune(csvFormulaPrefixes, rune(rest[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVFormula reverses escapeCSVFormula(), so that an exported file can be imported
+// again without the "'" which was added ending up in the tasks.
+func unescapeCSVFormula(value string) string {
+	if strings.HasPrefix(value, "'") && escapeCSVFormula(value[1:]) == value {
+		return value[1:]
+	}
+	return value
+}
+
+// ndjsonTaskWriter writes each task as a JSON object on a line of its own.
+type ndjsonTaskWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONTaskWriter(w io.Writer) *ndjsonTaskWriter {
+	bw := bufio.NewWriter(w)
+	return &ndjsonTaskWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (tw *ndjsonTaskWriter) Write(task *data.Task) error {
+	return tw.enc.Encode(task)
+}
+
+func (tw *ndjsonTaskWriter) Flush() error {
+	return tw.w.Flush()
+}
@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
 	"github.com/Bayashat/TaskNinja/internal/validator"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -17,10 +20,17 @@ import (
 // Retrieve the "id" URL parameter from the current request context, then convert it to an integer and return it.
 // If the operation isn't successful, return 0 and an error.
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// The readNamedIDParam() helper works in the same way as readIDParam(), but for routes
+// which carry a second ID in a URL parameter with a different name, such as
+// /v1/tasks/:id/collaborators/:user_id.
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
@@ -153,6 +163,77 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// The readIDs() helper reads a comma-separated list of IDs from the query string, using
+// readCSV(). It returns nil if no matching key could be found, and records an error
+// message in the provided Validator instance if any of the values isn't an integer.
+func (app *application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	var ids []int64
+	for _, s := range app.readCSV(qs, key, nil) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			v.AddError(key, "must be a comma-separated list of integer values")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// The readTime() helper reads a date or date-time value from the query string. It
+// accepts dates in the form "2006-01-02", date-times in the same form as the due_date
+// field, and RFC 3339 timestamps. Like readInt(), it returns the provided default value if
+// no matching key could be found, and records an error message in the provided Validator
+// instance if the value couldn't be parsed.
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+	v.AddError(key, "must be a date (YYYY-MM-DD) or date-time (YYYY-MM-DD HH:MM:SS)")
+	return defaultValue
+}
+
+// The readBool() helper reads a boolean value from the query string. Like readInt(), it
+// returns the provided default value if no matching key could be found, and records an
+// error message in the provided Validator instance if the value couldn't be converted.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// The cursorLinks() helper returns the headers for a page of results in cursor mode,
+// with an RFC 8288 Link header pointing at the first page and, if there is one, the next.
+// The links repeat the request's query string, with only the cursor changed.
+func (app *application) cursorLinks(r *http.Request, metadata data.Metadata) http.Header {
+	link := func(cursor, rel string) string {
+		qs := r.URL.Query()
+		qs.Set("cursor", cursor)
+		u := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+		return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+	}
+	links := []string{link("", "first")}
+	if metadata.NextCursor != "" {
+		links = append(links, link(metadata.NextCursor, "next"))
+	}
+	headers := make(http.Header)
+	headers.Set("Link", strings.Join(links, ", "))
+	return headers
+}
+
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter.
 	app.wg.Add(1)
@@ -168,3 +249,42 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// The readMultipartFile() helper returns the part of a multipart/form-data request body
+// holding the file in the named form field. Unlike r.FormFile() it doesn't buffer the
+// file in memory or on disk first, so the caller can stream it to wherever it's going.
+// Any form fields before the file are skipped.
+func (app *application) readMultipartFile(r *http.Request, field string) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("body must be multipart/form-data")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.Is(err, io.EOF):
+				return nil, fmt.Errorf("body must contain a file in the %q field", field)
+			case errors.As(err, &maxBytesError):
+				return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			default:
+				return nil, fmt.Errorf("body contains badly-formed multipart data: %w", err)
+			}
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// The readUploadedFile() helper returns the file that was sent with a request, either in
+// the given field of a multipart/form-data body or as the whole body. The caller should
+// close it once it has been read.
+func (app *application) readUploadedFile(r *http.Request, field string) (io.ReadCloser, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return app.readMultipartFile(r, field)
+	}
+	return r.Body, nil
+}
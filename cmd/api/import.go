@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize is the largest file accepted by the import, and maxImportRows is the
+// largest number of tasks that it can hold.
+const (
+	maxImportSize = 10 << 20
+	maxImportRows = 5000
+)
+
+// importRow is a task read from an imported file, along with the number of the line that
+// it starts on and any errors in the values which were read for it. id is the ID that the
+// task had in the file, such as the ID of an exported task, or 0 if it didn't have one.
+type importRow struct {
+	line   int
+	id     int64
+	input  createTaskInput
+	errors map[string]string
+}
+
+// The importTasksHandler creates tasks from a file in one of the formats written by the
+// export, CSV (the default) or newline-delimited JSON, which is either uploaded in the
+// "file" field of a multipart/form-data body or sent as the body itself. The columns or
+// fields that the server sets, such as id and created_at, are ignored, so an export can be
+// imported as it is. A parent_id which matches the id of another row refers to the task
+// created for that row, so subtasks keep their parents when an export is imported again.
+// Every row is checked in the same way as a task sent to
+// POST /v1/tasks, and the tasks are only created if all of them pass; otherwise the
+// errors are returned keyed by the line number of the row. With dry_run=true the rows are
+// checked and the errors returned, but nothing is created.
+func (app *application) importTasksHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	format := app.readString(qs, "format", "csv")
+	v.Check(validator.In(format, "csv", "ndjson"), "format", "must be either csv or ndjson")
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, err := app.readUploadedFile(r, "file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	var rows []importRow
+	switch format {
+	case "csv":
+		rows, err = readCSVTasks(file)
+	case "ndjson":
+		rows, err = readNDJSONTasks(file)
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	v.Check(len(rows) > 0, "file", "must contain at least one task")
+	v.Check(len(rows) <= maxImportRows, "file", fmt.Sprintf("must not contain more than %d tasks", maxImportRows))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The tasks are created in a transaction, which is only committed if every one of
+	// them could be created. The checks of each row are made on the transaction too, so
+	// that a row can use a task created by an earlier row as its parent, and the rows of a
+	// dry run are checked exactly as a real import would check them.
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	tx, err := app.models.Tasks.DB.BeginTx(ctx, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	models := app.models.WithTx(tx)
+
+	// fileIDs holds the IDs that the rows had in the file, and created maps those of the
+	// rows imported so far to the IDs of the tasks created for them.
+	fileIDs := make(map[int64]bool)
+	for _, row := range rows {
+		if row.id != 0 {
+			fileIDs[row.id] = true
+		}
+	}
+	created := make(map[int64]int64)
+
+	user := app.contextGetUser(r)
+	rowErrors := make(map[string]map[string]string)
+	for _, row := range rows {
+		key := strconv.Itoa(row.line)
+		if row.errors != nil {
+			rowErrors[key] = row.errors
+			continue
+		}
+		if row.input.ParentID != nil && fileIDs[*row.input.ParentID] {
+			parentID, ok := created[*row.input.ParentID]
+			if !ok {
+				rowErrors[key] = map[string]string{"parent_id": "must refer to a row earlier in the file which can be imported"}
+				continue
+			}
+			row.input.ParentID = &parentID
+		}
+		task, err := app.createTask(models, user, row.input)
+		if err != nil {
+			var validationError failedValidationError
+			switch {
+			case errors.As(err, &validationError):
+				rowErrors[key] = validationError.errors
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			continue
+		}
+		if row.id != 0 {
+			created[row.id] = task.ID
+		}
+	}
+
+	if dryRun {
+		err = app.writeJSON(w, http.StatusOK, envelope{"errors": rowErrors}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, rowErrors)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"imported": len(rows)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCSVTasks reads the rows of a CSV file with a header row naming its columns, which
+// can be any of the columns of the export in any order.
+func readCSVTasks(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	// Rows with the wrong number of fields are reported along with the other errors in
+	// the row, rather than stopping the import.
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, csvError(err)
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		// Spreadsheet applications often start the file with a byte order mark.
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(taskCSVColumns, name) {
+			return nil, fmt.Errorf("CSV header contains unknown column %q", name)
+		}
+		if slices.Contains(columns[:i], name) {
+			return nil, fmt.Errorf("CSV header contains column %q more than once", name)
+		}
+		columns[i] = name
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return rows, nil
+			}
+			return nil, csvError(err)
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, csvTaskRow(columns, record, line))
+	}
+}
+
+// csvError turns an error from reading a CSV file into one which can be sent to the client.
+func csvError(err error) error {
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return fmt.Errorf("body contains badly-formed CSV on line %d: %s", parseError.Line, parseError.Err)
+	}
+	return err
+}
+
+// csvTaskRow reads a task from a CSV record with the given columns.
+func csvTaskRow(columns, record []string, line int) importRow {
+	row := importRow{line: line}
+	if len(record) != len(columns) {
+		row.errors = map[string]string{"row": fmt.Sprintf("must have %d fields", len(columns))}
+		return row
+	}
+	v := validator.New()
+	for i, column := range columns {
+		value := unescapeCSVFormula(record[i])
+		switch column {
+		case "id":
+			if id := parseCSVID(v, column, value); id != nil {
+				row.id = *id
+			}
+		case "title":
+			row.input.Title = value
+		case "description":
+			row.input.Description = value
+		case "priority":
+			row.input.Priority = value
+		case "status":
+			row.input.Status = value
+		case "category":
+			row.input.Category = value
+		case "recurrence":
+			row.input.Recurrence = value
+		case "tags":
+			row.input.Tags = splitCSVList(value)
+		case "due_date":
+			if value == "" {
+				continue
+			}
+			t, err := parseImportTime(value)
+			if err != nil {
+				v.AddError("due_date", "must be in the format YYYY-MM-DD HH:MM:SS or YYYY-MM-DD")
+				continue
+			}
+			row.input.DueDate = data.CustomTime(t)
+		case "reminders":
+			if value == "" {
+				continue
+			}
+			reminders, err := data.ParseReminders(splitCSVList(value))
+			if err != nil {
+				v.AddError("reminders", "must be a comma-separated list of offsets such as 1d, 2h or 1h30m")
+				continue
+			}
+			row.input.Reminders = reminders
+		case "parent_id":
+			row.input.ParentID = parseCSVID(v, column, value)
+		case "project_id":
+			row.input.ProjectID = parseCSVID(v, column, value)
+		}
+		// The other columns hold values which are set by the server, and are ignored.
+	}
+	if !v.Valid() {
+		row.errors = v.Errors
+	}
+	return row
+}
+
+// splitCSVList splits a comma-separated list in a CSV field, dropping empty values.
+func splitCSVList(value string) []string {
+	var values []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// parseCSVID reads an optional ID from a CSV field, recording an error in the validator if
+// it isn't a positive integer.
+func parseCSVID(v *validator.Validator, column, value string) *int64 {
+	if value == "" {
+		return nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		v.AddError(column, "must be a positive integer")
+		return nil
+	}
+	return &id
+}
+
+// parseImportTime reads a time in the layout of the export, or a date on its own.
+func parseImportTime(value string) (time.Time, error) {
+	t, err := time.Parse(exportTimeLayout, value)
+	if err != nil {
+		return time.Parse("2006-01-02", value)
+	}
+	return t, nil
+}
+
+// readNDJSONTasks reads a file with a JSON object on each line, holding the same fields as
+// the body of POST /v1/tasks. Blank lines are skipped, and unknown fields are ignored so
+// that the tasks written by the export can be read back.
+func readNDJSONTasks(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var rows []importRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := importRow{line: line}
+		err := json.Unmarshal(text, &row.input)
+		if err != nil {
+			row.errors = map[string]string{"row": ndjsonError(err)}
+		} else {
+			// The ID isn't part of the input for a new task, so it's read on its own.
+			var ref struct {
+				ID int64 `json:"id"`
+			}
+			if json.Unmarshal(text, &ref) != nil || ref.ID < 0 {
+				row.errors = map[string]string{"id": "must be a positive integer"}
+			}
+			row.id = ref.ID
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("body contains a line longer than %d bytes", 1<<20)
+		}
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ndjsonError describes an error decoding a line of newline-delimited JSON, in the same
+// way as readJSON() describes errors in a request body.
+func ndjsonError(err error) string {
+	var (
+		syntaxError        *json.SyntaxError
+		unmarshalTypeError *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Sprintf("contains badly-formed JSON (at character %d)", syntaxError.Offset)
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Sprintf("contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Sprintf("contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+	case errors.Is(err, data.ErrInvalidTimeFormat):
+		return "contains a due_date which isn't in the format YYYY-MM-DD HH:MM:SS"
+	case errors.Is(err, data.ErrInvalidReminderFormat):
+		return "contains reminders which aren't offsets such as 1d, 2h or 1h30m"
+	default:
+		return "contains badly-formed JSON"
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/Bayashat/TaskNinja/internal/data"
 	"github.com/Bayashat/TaskNinja/internal/jsonlog"
 	"github.com/Bayashat/TaskNinja/internal/mailer"
+	"github.com/Bayashat/TaskNinja/internal/storage"
 	"os"
 	"strings"
 	"sync"
@@ -50,16 +51,53 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	// The reminders struct holds the settings for the background loop which emails users
+	// about tasks that are nearly due. Tasks without reminder offsets of their own are
+	// reminded once they're due within the window.
+	reminders struct {
+		enabled  bool
+		interval time.Duration
+		window   time.Duration
+	}
+	// The attachments struct holds the limits on uploaded files, in bytes, and how long
+	// an upload or download may take. A maxUserSize of 0 disables the per-user quota.
+	attachments struct {
+		maxFileSize int64
+		maxUserSize int64
+		timeout     time.Duration
+	}
+	// The trash struct holds how long deleted tasks are kept in the trash before they are
+	// purged for good, and how often to look for tasks to purge.
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	// The storage struct holds the settings for the backend which stores uploaded files.
+	storage struct {
+		dir string
+	}
+	// The tasks struct holds the limits on tasks. Descriptions are Markdown, so they're
+	// allowed to be much longer than titles.
+	tasks struct {
+		maxDescriptionLength int
+	}
+	// The workflow field holds the status transitions that tasks are allowed to make.
+	workflow data.Workflow
+	// baseURL is the URL that clients reach the API at, such as https://api.example.com,
+	// which is used for links that leave the API, like calendar feed URLs. If it is empty,
+	// the links are built from the host of the request.
+	baseURL string
 }
 
 // Change the logger field to have the type *jsonlog.Logger, instead of
 // *log.Logger.
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *jsonlog.Logger
+	models  data.Models
+	mailer  mailer.Mailer
+	storage storage.Storage
+	wg      sync.WaitGroup
 }
 
 func main() {
@@ -67,6 +105,7 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.baseURL, "base-url", "", "Public base URL of the API (defaults to the host of each request)")
 
 	// Use the value of the GREENLIGHT_DB_DSN environment variable as the default value
 	// for our db-dsn command-line flag.
@@ -104,6 +143,32 @@ func main() {
 		cfg.cors.trustedOrigins = strings.Fields(val)
 		return nil
 	})
+
+	// Use the default workflow unless the -status-transitions flag replaces it, with the
+	// transitions in the format understood by data.ParseWorkflow().
+	cfg.workflow = data.DefaultWorkflow
+	flag.Func("status-transitions", "Allowed task status transitions (space separated from:to1,to2)", func(val string) error {
+		workflow, err := data.ParseWorkflow(val)
+		if err != nil {
+			return err
+		}
+		cfg.workflow = workflow
+		return nil
+	})
+
+	flag.BoolVar(&cfg.reminders.enabled, "reminders-enabled", true, "Enable due date reminder emails")
+	flag.DurationVar(&cfg.reminders.interval, "reminders-interval", time.Minute, "How often to scan for due reminders")
+	flag.DurationVar(&cfg.reminders.window, "reminders-window", 24*time.Hour, "Default reminder offset for tasks without their own")
+
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory to store uploaded files in")
+	flag.Int64Var(&cfg.attachments.maxFileSize, "attachments-max-file-size", 10<<20, "Maximum size of an attachment in bytes")
+	flag.Int64Var(&cfg.attachments.maxUserSize, "attachments-max-user-size", 100<<20, "Maximum total size of each user's attachments in bytes (0 for no limit)")
+	flag.DurationVar(&cfg.attachments.timeout, "attachments-timeout", 5*time.Minute, "Maximum time an attachment upload or download may take")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted tasks are kept in the trash")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often to purge expired tasks from the trash")
+
+	flag.IntVar(&cfg.tasks.maxDescriptionLength, "task-description-max-length", 20000, "Maximum length of a task description in bytes")
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
@@ -124,12 +189,20 @@ func main() {
 	// Likewise use the PrintInfo() method to write a message at the INFO level.
 	logger.PrintInfo("database connection pool established", nil)
 
+	// Open the storage backend for attachments. The local filesystem is the only one we
+	// have for now.
+	store, err := storage.NewLocal(cfg.storage.dir)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	// Initialize a new Mailer instance using the settings from the command line flags, and add it to the application struct.
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:  cfg,
+		logger:  logger,
+		models:  data.NewModels(db),
+		mailer:  mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		storage: store,
 	}
 	// Call app.serve() to start the server.
 	err = app.serve()
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/markdown"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/url"
+)
+
+// descriptionRenderer renders task descriptions from Markdown to HTML, linking references
+// to other tasks, such as #123, to the URLs of those tasks.
+var descriptionRenderer = markdown.Renderer{
+	TaskURL: func(id int64) string {
+		return fmt.Sprintf("/v1/tasks/%d", id)
+	},
+}
+
+// The readRender() helper reads the render parameter from the query string, which clients
+// set to html to have the description of each task in the response rendered as HTML in its
+// description_html field. It returns whether the descriptions should be rendered.
+func (app *application) readRender(qs url.Values, v *validator.Validator) bool {
+	render := app.readString(qs, "render", "")
+	v.Check(validator.In(render, "", "html"), "render", "must be html")
+	return render == "html"
+}
+
+// renderDescriptions sets the DescriptionHTML field of each of the tasks. The HTML is built
+// from escaped text and a fixed set of tags and attributes, so it's safe to put in a page.
+func renderDescriptions(tasks ...*data.Task) {
+	for _, task := range tasks {
+		if task != nil {
+			task.DescriptionHTML = descriptionRenderer.Render(task.Description)
+		}
+	}
+}
+
+// renderTreeDescriptions renders the descriptions of every task in a tree.
+func renderTreeDescriptions(tree *data.TaskTree) {
+	renderDescriptions(tree.Task)
+	for _, subtree := range tree.Subtasks {
+		renderTreeDescriptions(subtree)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+)
+
+func (app *application) createProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string               `json:"name"`
+		Description string               `json:"description"`
+		Settings    data.ProjectSettings `json:"settings"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// The project is owned by the user creating it.
+	project := &data.Project{
+		Name:        input.Name,
+		Description: input.Description,
+		UserID:      app.contextGetUser(r).ID,
+		Settings:    input.Settings,
+	}
+	v := validator.New()
+	if data.ValidateProject(v, project); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Projects.Insert(project)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/projects/%d", project.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"project": project}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showProjectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	project, err := app.models.Projects.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"project": project}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	project, err := app.models.Projects.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Name        *string               `json:"name"`
+		Description *string               `json:"description"`
+		Archived    *bool                 `json:"archived"`
+		Settings    *data.ProjectSettings `json:"settings"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		project.Name = *input.Name
+	}
+	if input.Description != nil {
+		project.Description = *input.Description
+	}
+	if input.Settings != nil {
+		project.Settings = *input.Settings
+	}
+	// Editors can change the details of a project, but archiving or restoring it hides or
+	// shows every task in it, so that is kept for the owner role.
+	if input.Archived != nil && *input.Archived != project.Archived {
+		role, _, err := app.models.Projects.GetRole(id, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !data.RoleIncludes(role, data.RoleOwner) {
+			app.notPermittedResponses(w, r)
+			return
+		}
+		project.Archived = *input.Archived
+	}
+	v := validator.New()
+	if data.ValidateProject(v, project); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Projects.Update(project)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"project": project}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// The tasks in the project aren't deleted with it; they just leave the project.
+	err = app.models.Projects.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "project successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Archived bool
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	// Archived projects are listed separately from the active ones.
+	input.Archived = app.readBool(qs, "archived", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	projects, metadata, err := app.models.Projects.GetAll(app.contextGetUser(r).ID, input.Archived, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"projects": projects, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listProjectMembersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	members, err := app.models.ProjectMembers.GetAllForProject(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Members are added by email address, in the same way as task collaborators.
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	member := &data.ProjectMember{
+		ProjectID: id,
+		Role:      input.Role,
+	}
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	if data.ValidateProjectMember(v, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	project, err := app.models.Projects.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if project.UserID == user.ID {
+		v.AddError("email", "this user already owns the project")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	member.UserID = user.ID
+	member.Name = user.Name
+	member.Email = user.Email
+	err = app.models.ProjectMembers.Insert(member)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Anybody with the owner role can remove a member, and every member is allowed to
+	// leave a project that they were added to.
+	user := app.contextGetUser(r)
+	if userID != user.ID {
+		role, _, err := app.models.Projects.GetRole(id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.RoleIncludes(role, data.RoleOwner) {
+			app.notPermittedResponses(w, r)
+			return
+		}
+	}
+	err = app.models.ProjectMembers.Delete(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateTaskProject checks that the user is allowed to put the task in the project it
+// refers to, if any, recording a validation error if not. The project is returned when it
+// passes the checks, so that its settings can be applied to the task.
+func (app *application) validateTaskProject(v *validator.Validator, projects data.ProjectModel, task *data.Task, userID int64) (*data.Project, error) {
+	if task.ProjectID == nil || *task.ProjectID < 1 {
+		return nil, nil
+	}
+	role, _, err := projects.GetRole(*task.ProjectID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("project_id", "must refer to an existing project")
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	if !data.RoleIncludes(role, data.RoleEditor) {
+		v.AddError("project_id", "must refer to a project that you can edit")
+		return nil, nil
+	}
+	project, err := projects.Get(*task.ProjectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if project.Archived {
+		v.AddError("project_id", "must not refer to an archived project")
+		return nil, nil
+	}
+	return project, nil
+}
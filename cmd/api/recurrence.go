@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+	"time"
+)
+
+// maxOccurrences is the most occurrences that a single preview will return.
+const maxOccurrences = 500
+
+func (app *application) listTaskOccurrencesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// By default, preview the occurrences over the next 90 days.
+	v := validator.New()
+	qs := r.URL.Query()
+	from := app.readTime(qs, "from", time.Now(), v)
+	to := app.readTime(qs, "to", from.AddDate(0, 0, 90), v)
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Before(from.AddDate(10, 0, 0)), "to", "must be within 10 years of from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	task, err := app.models.Tasks.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	occurrences, err := task.Occurrences(from, to, maxOccurrences)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"occurrences": occurrences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"strconv"
+	"time"
+)
+
+// The runReminders() method is the reminder scheduler. It sends any reminders which are
+// due straight away, and then again every reminders-interval, until ctx is cancelled
+// during shutdown. It should be started with app.background(), so that the server waits
+// for an in-flight batch of emails to finish before exiting.
+func (app *application) runReminders(ctx context.Context) {
+	ticker := time.NewTicker(app.config.reminders.interval)
+	defer ticker.Stop()
+	for {
+		app.sendReminders(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// The sendReminders() method emails each reminder which is currently due and records it
+// as sent. A reminder which fails to send is left unrecorded, so that it is retried on
+// the next scan.
+func (app *application) sendReminders(ctx context.Context) {
+	reminders, err := app.models.Reminders.GetDue(app.config.reminders.window)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, reminder := range reminders {
+		if ctx.Err() != nil {
+			return
+		}
+		err = app.mailer.Send(reminder.UserEmail, "task_reminder.tmpl", reminderData(reminder))
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task_id": strconv.FormatInt(reminder.TaskID, 10)})
+			continue
+		}
+		err = app.models.Reminders.MarkSent(reminder)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"task_id": strconv.FormatInt(reminder.TaskID, 10)})
+		}
+	}
+}
+
+func reminderData(reminder *data.Reminder) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    reminder.UserName,
+		"taskID":  reminder.TaskID,
+		"title":   reminder.Title,
+		"dueDate": reminder.DueDate.UTC().Format("2006-01-02 15:04 MST"),
+		"dueIn":   time.Until(reminder.DueDate).Round(time.Minute).String(),
+	}
+}
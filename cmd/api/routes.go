@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/Bayashat/TaskNinja/internal/data"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -25,15 +26,98 @@ func (app *application) routes() http.Handler {
 	// passing in the required permission code as the first parameter.
 	router.HandlerFunc(http.MethodGet, "/v1/tasks", app.requirePermission("tasks:read", app.listTasksHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/tasks", app.requirePermission("tasks:write", app.createTaskHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id", app.requirePermission("tasks:read", app.showTaskHandler))
+	// Routes for a single task use requireTaskPermission() instead, which also takes the
+	// role that the user needs to hold on the task.
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id", app.requireTaskPermission("tasks:read", data.RoleViewer, app.showTaskHandler))
 	// Require a PATCH request, rather than PUT.
-	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id", app.requirePermission("tasks:write", app.updateTaskHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id", app.requirePermission("tasks:write", app.deleteTaskHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id", app.requireTaskPermission("tasks:write", data.RoleEditor, app.updateTaskHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id", app.requireTaskPermission("tasks:write", data.RoleOwner, app.deleteTaskHandler))
+
+	// httprouter doesn't allow a static path such as /v1/tasks/batch alongside the :id
+	// parameter, so the endpoints which work on many tasks at once have paths of their own.
+	router.HandlerFunc(http.MethodPost, "/v1/task-batches", app.requirePermission("tasks:write", app.batchTasksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/task-exports", app.requirePermission("tasks:read", app.exportTasksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/task-imports", app.requirePermission("tasks:write", app.importTasksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/task-imports/ical", app.requirePermission("tasks:write", app.importICalHandler))
+
+	// Deleted tasks go to the trash, from where they can be restored until they're purged.
+	router.HandlerFunc(http.MethodGet, "/v1/trash", app.requirePermission("tasks:read", app.listTrashHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/restore", app.requirePermission("tasks:write", app.restoreTaskHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/subtasks", app.requireTaskPermission("tasks:read", data.RoleViewer, app.listSubtasksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/tree", app.requireTaskPermission("tasks:read", data.RoleViewer, app.showTaskTreeHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/history", app.requireTaskPermission("tasks:read", data.RoleViewer, app.listTaskHistoryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/occurrences", app.requireTaskPermission("tasks:read", data.RoleViewer, app.listTaskOccurrencesHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/dependencies", app.requireTaskPermission("tasks:write", data.RoleEditor, app.addTaskDependencyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/dependencies/:blocked_by_id", app.requireTaskPermission("tasks:write", data.RoleEditor, app.removeTaskDependencyHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/collaborators", app.requireTaskPermission("tasks:read", data.RoleViewer, app.listTaskCollaboratorsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/collaborators", app.requireTaskPermission("tasks:write", data.RoleOwner, app.addTaskCollaboratorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/collaborators/:user_id", app.requireActivatedUser(app.removeTaskCollaboratorHandler))
+
+	// Anybody who can read a task can read and add comments on it. Editing and deleting
+	// comments are further restricted to their authors in the handlers.
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/comments", app.requireTaskPermission("tasks:read", data.RoleViewer, app.listTaskCommentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/comments", app.requireTaskPermission("tasks:read", data.RoleViewer, app.createTaskCommentHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id/comments/:comment_id", app.requireTaskPermission("tasks:read", data.RoleViewer, app.updateTaskCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/comments/:comment_id", app.requireTaskPermission("tasks:read", data.RoleViewer, app.deleteTaskCommentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/attachments", app.requireTaskPermission("tasks:read", data.RoleViewer, app.listTaskAttachmentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/attachments", app.requireTaskPermission("tasks:write", data.RoleEditor, app.uploadTaskAttachmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/attachments/:attachment_id", app.requireTaskPermission("tasks:read", data.RoleViewer, app.showTaskAttachmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/attachments/:attachment_id/content", app.requireTaskPermission("tasks:read", data.RoleViewer, app.downloadTaskAttachmentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/attachments/:attachment_id", app.requireTaskPermission("tasks:write", data.RoleEditor, app.deleteTaskAttachmentHandler))
+
+	// Time is tracked against tasks with timers, of which each user can only have one
+	// running at a time, or with entries added by hand. Stopping a timer only touches the
+	// user's own timer, so it doesn't need a role on the task.
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/timer/start", app.requireTaskPermission("tasks:write", data.RoleEditor, app.startTaskTimerHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/timer/stop", app.requirePermission("tasks:write", app.stopTaskTimerHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/time-entries", app.requireTaskPermission("tasks:read", data.RoleViewer, app.listTaskTimeEntriesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/time-entries", app.requireTaskPermission("tasks:write", data.RoleEditor, app.createTaskTimeEntryHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/time-entries/:entry_id", app.requireTaskPermission("tasks:write", data.RoleViewer, app.deleteTaskTimeEntryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/timer", app.requirePermission("tasks:read", app.showTimerHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reports/time", app.requirePermission("tasks:read", app.showTimeReportHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tags", app.requirePermission("tasks:read", app.listTagsHandler))
+
+	// Projects use requireProjectPermission() in the same way that single tasks use
+	// requireTaskPermission().
+	router.HandlerFunc(http.MethodGet, "/v1/projects", app.requirePermission("tasks:read", app.listProjectsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/projects", app.requirePermission("tasks:write", app.createProjectHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/projects/:id", app.requireProjectPermission("tasks:read", data.RoleViewer, app.showProjectHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/projects/:id", app.requireProjectPermission("tasks:write", data.RoleEditor, app.updateProjectHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/projects/:id", app.requireProjectPermission("tasks:write", data.RoleOwner, app.deleteProjectHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/projects/:id/members", app.requireProjectPermission("tasks:read", data.RoleViewer, app.listProjectMembersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/projects/:id/members", app.requireProjectPermission("tasks:write", data.RoleOwner, app.addProjectMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/projects/:id/members/:user_id", app.requireActivatedUser(app.removeProjectMemberHandler))
+
+	// Saved views are owned by one user, who can share them read-only with others.
+	router.HandlerFunc(http.MethodGet, "/v1/views", app.requirePermission("tasks:read", app.listViewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/views", app.requirePermission("tasks:write", app.createViewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/views/:id", app.requireViewPermission("tasks:read", data.RoleViewer, app.showViewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/views/:id", app.requireViewPermission("tasks:write", data.RoleOwner, app.updateViewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/views/:id", app.requireViewPermission("tasks:write", data.RoleOwner, app.deleteViewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/views/:id/tasks", app.requireViewPermission("tasks:read", data.RoleViewer, app.showViewTasksHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/views/:id/shares", app.requireViewPermission("tasks:read", data.RoleOwner, app.listViewSharesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/views/:id/shares", app.requireViewPermission("tasks:write", data.RoleOwner, app.shareViewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/views/:id/shares/:user_id", app.requireActivatedUser(app.unshareViewHandler))
 
 	// Add the route for the POST /v1/users endpoint.
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	// Add the route for the PUT /v1/users/activated endpoint.
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	// Users can change their own details, such as the language used for full-text search.
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.updateUserHandler))
+	// The calendar feed URL is secret, and is issued, regenerated and revoked here. The
+	// feed itself is read by calendar applications with just the token in the URL.
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/calendar-feed", app.requirePermission("tasks:read", app.createCalendarFeedHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/calendar-feed", app.requireActivatedUser(app.revokeCalendarFeedHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/calendar/:token/tasks.ics", app.showCalendarFeedHandler)
 
 	// Add the route for the POST /v1/tokens/authentication endpoint.
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
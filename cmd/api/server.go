@@ -19,6 +19,19 @@ func (app *application) serve() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	// Create a context for the long-running background loops, such as the reminder
+	// scheduler and the trash purge. It is cancelled when the server shuts down, which tells the loops to
+	// stop before we wait for the background goroutines to complete.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if app.config.reminders.enabled {
+		app.background(func() {
+			app.runReminders(ctx)
+		})
+	}
+	app.background(func() {
+		app.runPurge(ctx)
+	})
 	// Create a shutdownError channel. We will use this to receive any errors returned
 	// by the graceful Shutdown() function.
 	shutdownError := make(chan error)
@@ -37,6 +50,8 @@ func (app *application) serve() error {
 		if err != nil {
 			shutdownError <- err
 		}
+		// Stop the background loops from starting any new work.
+		stop()
 		// Log a message to say that we're waiting for any background goroutines to
 		// complete their tasks.
 		app.logger.PrintInfo("completing background tasks", map[string]string{
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+)
+
+func (app *application) listSubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	render := app.readRender(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	subtasks, err := app.models.Tasks.GetSubtasks(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if render {
+		renderDescriptions(subtasks...)
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"subtasks": subtasks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTaskTreeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	render := app.readRender(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tree, err := app.models.Tasks.GetTree(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if render {
+		renderTreeDescriptions(tree)
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": tree}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The validateTaskParent() helper checks the parent that a task is being attached to,
+// recording any problems in the provided Validator instance. The user must be able to
+// edit the parent, and the parent mustn't be the task itself or one of its own
+// descendants, since that would turn the hierarchy into a loop.
+func (app *application) validateTaskParent(v *validator.Validator, tasks data.TaskModel, task *data.Task, userID int64) error {
+	if task.ParentID == nil || !v.Valid() {
+		return nil
+	}
+	role, _, err := tasks.GetRole(*task.ParentID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must refer to an existing task")
+			return nil
+		default:
+			return err
+		}
+	}
+	if !data.RoleIncludes(role, data.RoleEditor) {
+		v.AddError("parent_id", "must refer to a task that you can edit")
+		return nil
+	}
+	// A task that hasn't been inserted yet can't have any descendants.
+	if task.ID == 0 {
+		return nil
+	}
+	loop, err := tasks.InSubtree(task.ID, *task.ParentID)
+	if err != nil {
+		return err
+	}
+	v.Check(!loop, "parent_id", "must not refer to one of the task's own subtasks")
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+)
+
+// The listTagsHandler returns the tags on the tasks that the user can see, with the number
+// of tasks carrying each of them.
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.models.Tags.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
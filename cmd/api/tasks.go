@@ -6,61 +6,148 @@ import (
 	"github.com/Bayashat/TaskNinja/internal/data"
 	"github.com/Bayashat/TaskNinja/internal/validator"
 	"net/http"
+	"net/url"
+	"slices"
+	"time"
 )
 
+// createTaskInput holds the information that we expect to be in the request body when
+// creating a task (note that the field names and types in the struct are a subset of the
+// Task struct). It is shared by createTaskHandler and the batch endpoint.
+type createTaskInput struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	DueDate     data.CustomTime `json:"due_date"`
+	Priority    string          `json:"priority"`
+	Status      string          `json:"status"`
+	Category    string          `json:"category"`
+	Tags        []string        `json:"tags"`
+	ParentID    *int64          `json:"parent_id"`
+	ProjectID   *int64          `json:"project_id"`
+	Recurrence  string          `json:"recurrence"`
+	Reminders   data.Reminders  `json:"reminders"`
+	// ICalUID is only set by the iCalendar import, never from a request body.
+	ICalUID string `json:"-"`
+}
+
+// updateTaskInput holds the fields of a task which can be changed by an update. Pointers
+// are used so that we can tell the fields which were left out apart from the ones which
+// were set to their zero value. Version is optional: if it is given, the update only
+// goes ahead if the task is still at that version.
+type updateTaskInput struct {
+	Title       *string          `json:"title"`
+	Description *string          `json:"description"`
+	DueDate     *data.CustomTime `json:"due_date"`
+	Priority    *string          `json:"priority"`
+	Status      *string          `json:"status"`
+	Category    *string          `json:"category"`
+	Tags        *[]string        `json:"tags"`
+	ParentID    *int64           `json:"parent_id"`
+	ProjectID   *int64           `json:"project_id"`
+	Recurrence  *string          `json:"recurrence"`
+	Reminders   *data.Reminders  `json:"reminders"`
+	Version     *int32           `json:"version"`
+}
+
+// failedValidationError carries the errors from a Validator out of the task operations
+// below, so that the caller can report them in whatever way suits it.
+type failedValidationError struct {
+	errors map[string]string
+}
+
+func (e failedValidationError) Error() string {
+	return "failed validation"
+}
+
 func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request) {
-	// Declare an anonymous struct to hold the information that we expect to be in the HTTP request body
-	// (note that the field names and types in the struct are a subset of the Movie struct that we created earlier).
-	// This struct will be our *target  decode destination*.
-	var input struct {
-		Title       string          `json:"title"`
-		Description string          `json:"description"`
-		DueDate     data.CustomTime `json:"due_date"`
-		Priority    string          `json:"priority"`
-		Status      string          `json:"status"`
-		Category    string          `json:"category"`
+	v := validator.New()
+	render := app.readRender(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
+	var input createTaskInput
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	// Copy the values from the input struct to a new Movie struct.
+	// The task is owned by the user making the request.
+	task, err := app.createTask(app.models, app.contextGetUser(r), input)
+	if err != nil {
+		app.taskErrorResponse(w, r, err)
+		return
+	}
+	if render {
+		renderDescriptions(task)
+	}
+	// When sending a HTTP response, we want to include a Location header to
+	//		let the client know which URL they can find the newly-created resource at.
+	// We make an empty http.Header map and then use the Set() method to add a new Location header,
+	// 		interpolating the system-generated ID for our new task in the URL.
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d", task.ID))
+	// Write a JSON response with a 201 Created status code, the task data in the response body, and the Location header.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"task": task}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTask validates and inserts a new task owned by the user, using the given models
+// so that the batch endpoint and the import can run it on a transaction. The checks are
+// made on the same models, so that they see the tasks created earlier in the transaction.
+func (app *application) createTask(models data.Models, user *data.User, input createTaskInput) (*data.Task, error) {
+	// Copy the values from the input struct to a new Task struct.
 	task := &data.Task{
 		Title:       input.Title,
 		Description: input.Description,
 		DueDate:     input.DueDate,
 		Priority:    input.Priority,
-		Status:      input.Status,
 		Category:    input.Category,
+		Tags:        data.NormalizeTags(input.Tags),
+		ParentID:    input.ParentID,
+		ProjectID:   input.ProjectID,
+		Reminders:   input.Reminders,
+		UserID:      user.ID,
+		ICalUID:     input.ICalUID,
 	}
+	// Setting the status through SetStatus() records when the task was started or completed.
+	task.SetStatus(input.Status, time.Now())
+	// A recurring task starts its series on its own due date.
+	task.SetRecurrence(input.Recurrence)
 
 	// Initialize a new Validator.
 	v := validator.New()
 
-	// Call the ValidateTask() function and return a response containing the errors if any of the checks fail.
-	if data.ValidateTask(v, task); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+	// A task created in a project takes the project's defaults for anything left out.
+	project, err := app.validateTaskProject(v, models.Projects, task, task.UserID)
+	if err != nil {
+		return nil, err
 	}
-	// Call the Insert() method on our tasks model, passing in a pointer to the validated task struct.
-	// This will create a record in the database and update the task struct with the system-generated information.
-	err = app.models.Tasks.Insert(task)
+	if project != nil {
+		project.Settings.ApplyTo(task)
+	}
+
+	// Call the ValidateTask() function and return the errors if any of the checks fail.
+	if data.ValidateTask(v, task, app.config.tasks.maxDescriptionLength); !v.Valid() {
+		return nil, failedValidationError{v.Errors}
+	}
+	// Check that the user is allowed to add a subtask to the parent task, if one was given.
+	err = app.validateTaskParent(v, models.Tasks, task, task.UserID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		return nil, err
 	}
-	// When sending a HTTP response, we want to include a Location header to
-	//		let the client know which URL they can find the newly-created resource at.
-	// We make an empty http.Header map and then use the Set() method to add a new Location header,
-	// 		interpolating the system-generated ID for our new task in the URL.
-	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d", task.ID))
-	// Write a JSON response with a 201 Created status code, the task data in the response body, and the Location header.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"task": task}, headers)
+	if !v.Valid() {
+		return nil, failedValidationError{v.Errors}
+	}
+	// Call the Insert() method on our tasks model, passing in a pointer to the validated task struct.
+	// This will create a record in the database and update the task struct with the system-generated information.
+	err = models.Tasks.Insert(task)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		return nil, err
 	}
+	return task, nil
 }
 
 // Add a showTaskHandler for the "GET /v1/task/:id" endpoint.
@@ -71,10 +158,18 @@ func (app *application) showTaskHandler(w http.ResponseWriter, r *http.Request)
 		app.notFoundResponse(w, r)
 		return
 	}
+	v := validator.New()
+	render := app.readRender(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 	// Call the Get() method to fetch the data for a specific task.
 	// We also need to use the errors.Is() function to check if it returns a data.ErrRecordNotFound error,
-	// in which case we send a 404 Not Found response to the client.
-	task, err := app.models.Tasks.Get(id)
+	// in which case we send a 404 Not Found response to the client. Tasks that belong to
+	// somebody else are reported in exactly the same way, so that their existence isn't leaked.
+	user := app.contextGetUser(r)
+	task, err := app.models.Tasks.Get(id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -84,7 +179,21 @@ func (app *application) showTaskHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
+	// Report the tasks that this task is waiting for, and the tasks waiting for it.
+	blockedBy, err := app.models.Dependencies.GetBlockedBy(task.ID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	blocking, err := app.models.Dependencies.GetBlocking(task.ID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if render {
+		renderDescriptions(task)
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": task, "blocked_by": blockedBy, "blocking": blocking}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -97,33 +206,53 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		app.notFoundResponse(w, r)
 		return
 	}
-	// Retrieve the task record as normal.
-	task, err := app.models.Tasks.Get(id)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+	v := validator.New()
+	render := app.readRender(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Use pointers for the fields.
-	var input struct {
-		Title       *string          `json:"title"`
-		Description *string          `json:"description"`
-		DueDate     *data.CustomTime `json:"due_date"`
-		Priority    *string          `json:"priority"`
-		Status      *string          `json:"status"`
-		Category    *string          `json:"category"`
-	}
-
-	// Decode the Json as normal
+	// Decode the JSON as normal.
+	var input updateTaskInput
 	err = app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	task, next, err := app.updateTask(app.models, app.contextGetUser(r), id, input)
+	if err != nil {
+		app.taskErrorResponse(w, r, err)
+		return
+	}
+	if render {
+		renderDescriptions(task, next)
+	}
+	env := envelope{"task": task}
+	if next != nil {
+		env["next_occurrence"] = next
+	}
+	// Write the updated task record in a JSON response.
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateTask applies the changes in the input to a task on behalf of the user. If the
+// update completes a recurring task, the task for its next occurrence is created and
+// returned as well.
+func (app *application) updateTask(models data.Models, user *data.User, id int64, input updateTaskInput) (*data.Task, *data.Task, error) {
+	tasks := models.Tasks
+	// Retrieve the task record as normal, scoped to the user making the request.
+	task, err := tasks.Get(id, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// If the client told us which version of the task it was changing, check that it
+	// hasn't been changed by somebody else since.
+	if input.Version != nil && *input.Version != task.Version {
+		return nil, nil, data.ErrEditConflict
+	}
 
 	// If the input.Title value is nil then we know that no corresponding "title"
 	//		key/value pair was provided in the JSON request body.
@@ -142,39 +271,118 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 	if input.Priority != nil {
 		task.Priority = *input.Priority
 	}
+	// Remember whether the task is being completed by this update, so that we can check
+	// that nothing is still blocking it.
+	completing := input.Status != nil && *input.Status == data.StatusCompleted && task.Status != data.StatusCompleted
+	// The workflow decides which statuses the task can move to from its current one.
+	v := validator.New()
 	if input.Status != nil {
-		task.Status = *input.Status
+		data.ValidateStatusTransition(v, app.config.workflow, task.Status, *input.Status)
+		task.SetStatus(*input.Status, time.Now())
 	}
 	if input.Category != nil {
 		task.Category = *input.Category
 	}
+	if input.Tags != nil {
+		task.Tags = data.NormalizeTags(*input.Tags)
+	}
 	if input.DueDate != nil {
 		task.DueDate = *input.DueDate
 	}
+	if input.Reminders != nil {
+		task.Reminders = *input.Reminders
+	}
+	// Changing the recurrence rule starts a new series from the task's current due date.
+	if input.Recurrence != nil {
+		task.SetRecurrence(*input.Recurrence)
+	}
+	// A parent_id of 0 detaches the task from its parent and makes it a top-level task again.
+	parentChanged := input.ParentID != nil
+	if parentChanged {
+		task.ParentID = input.ParentID
+		if *input.ParentID == 0 {
+			task.ParentID = nil
+		}
+	}
+	// Likewise a project_id of 0 takes the task out of its project. Moving a task between
+	// projects changes who has access to it, since project members get their project role
+	// on its tasks, so only the task's owners can do it.
+	projectChanged := input.ProjectID != nil && *input.ProjectID != projectIDOf(task)
+	if projectChanged {
+		err = app.checkTaskRole(tasks, task.ID, user.ID, data.RoleOwner)
+		if err != nil {
+			return nil, nil, err
+		}
+		task.ProjectID = input.ProjectID
+		if *input.ProjectID == 0 {
+			task.ProjectID = nil
+		}
+	}
 
-	// Validate the updated task record, sending the client a 422 Unprocessable Entity response if any checks fail.
-	v := validator.New()
-	if data.ValidateTask(v, task); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+	// Validate the updated task record, returning the errors if any checks fail.
+	if data.ValidateTask(v, task, app.config.tasks.maxDescriptionLength); !v.Valid() {
+		return nil, nil, failedValidationError{v.Errors}
+	}
+	if completing {
+		err = app.validateTaskBlockers(v, tasks, task, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if parentChanged {
+		err = app.validateTaskParent(v, tasks, task, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if projectChanged {
+		_, err = app.validateTaskProject(v, models.Projects, task, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if !v.Valid() {
+		return nil, nil, failedValidationError{v.Errors}
+	}
+	// When a recurring task is completed, its series carries on with a new task for the
+	// next occurrence. The completed task stops recurring, so that reopening and
+	// completing it again doesn't spawn the same occurrence twice.
+	var next *data.Task
+	if completing && task.Recurrence != "" {
+		next, err = task.NextOccurrence()
+		if err != nil {
+			return nil, nil, err
+		}
+		task.Recurrence = ""
+		task.RecurrenceStart = nil
+	}
+	// Update() returns ErrEditConflict if the task was changed since we read it, and so
+	// does UpdateWithNext(), which saves the completed task and its next occurrence
+	// together. Both check the new parent again under a lock, in case another request
+	// has changed the hierarchy since validateTaskParent() looked at it.
+	if next != nil {
+		err = tasks.UpdateWithNext(task, next, user.ID)
+	} else {
+		err = tasks.Update(task, user.ID)
 	}
-	// Intercept any ErrEditConflict error and call the new editConflictResponse() helper.
-	err = app.models.Tasks.Update(task)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrParentCycle):
+			v.AddError("parent_id", "must not refer to one of the task's own subtasks")
+			return nil, nil, failedValidationError{v.Errors}
 		default:
-			app.serverErrorResponse(w, r, err)
+			return nil, nil, err
 		}
-		return
 	}
+	return task, next, nil
+}
 
-	// Write the updated task record in a JSON response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
+// projectIDOf returns the ID of the project that a task is in, or 0 if it isn't in one.
+func projectIDOf(task *data.Task) int64 {
+	if task.ProjectID == nil {
+		return 0
 	}
+	return *task.ProjectID
 }
 
 func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -184,65 +392,198 @@ func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request
 		app.notFoundResponse(w, r)
 		return
 	}
-	// Delete the task from the database,
-	//		sending a 404 Not Found response to the client if there isn't a matching record.
-	err = app.models.Tasks.Delete(id)
+	// A task with subtasks is only deleted when the client explicitly asks for its whole
+	//		subtree to go with it, by passing cascade=true in the query string.
+	v := validator.New()
+	cascade := app.readBool(r.URL.Query(), "cascade", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.deleteTask(app.models.Tasks, app.contextGetUser(r), id, cascade)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.taskErrorResponse(w, r, err)
 		return
 	}
 	// Return a 200 OK status code along with a success message.
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "task successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "task successfully moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// deleteTask moves a task to the trash on behalf of the user. Unless cascade is set, a
+// task with subtasks is refused.
+func (app *application) deleteTask(tasks data.TaskModel, user *data.User, id int64, cascade bool) error {
+	if !cascade {
+		subtasks, err := tasks.CountSubtasks(id)
+		if err != nil {
+			return err
+		}
+		if subtasks > 0 {
+			v := validator.New()
+			v.AddError("cascade", fmt.Sprintf("must be true to delete a task with %d subtasks", subtasks))
+			return failedValidationError{v.Errors}
+		}
+	}
+	// Move the task (and any subtasks) to the trash, returning ErrRecordNotFound if
+	//		there isn't a matching record that the user is allowed to delete.
+	return tasks.Delete(id, user.ID)
+}
+
+// taskErrorResponse sends the response for an error returned by one of the task operations.
+func (app *application) taskErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var validationError failedValidationError
+	switch {
+	case errors.As(err, &validationError):
+		app.failedValidationResponse(w, r, validationError.errors)
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	case errors.Is(err, errNotPermitted):
+		app.notPermittedResponses(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	// Call r.URL.Query() to get the url.Values map containing the query string data.
+	app.listTasks(w, r, r.URL.Query())
+}
+
+// The listTasks() method sends the page of tasks selected by the filter, sort and
+// pagination parameters in qs. It is shared by listTasksHandler and showViewTasksHandler,
+// which read the parameters from different places. Only the tasks that the user can see
+// are listed.
+func (app *application) listTasks(w http.ResponseWriter, r *http.Request, qs url.Values) {
 	// Embed the new Filters struct.
 	var input struct {
-		Title string
+		data.TaskQuery
 		data.Filters
 	}
 	// Initialize a new Validator instance.
 	v := validator.New()
 
-	// Call r.URL.Query() to get the url.Values map containing the query string data.
-	qs := r.URL.Query()
-
-	input.Title = app.readString(qs, "title", "")
-
-	// Read the page and page_size query string values into the embedded struct.
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-
-	// Read the sort query string value into the embedded struct.
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-
-	// Add the supported sort values for this endpoint to the sort safelist.
-	input.Filters.SortSafelist = []string{"id", "title", "priority", "category", "-id", "-title", "-priority", "-category"}
-
-	// Execute the validation checks on the Filters struct and send a response containing the errors if necessary.
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+	// Read the filters, sort and pagination, and send a response containing the errors if
+	// any of them are invalid.
+	input.TaskQuery, input.Filters = app.readTaskListing(qs, v)
+	render := app.readRender(qs, v)
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	user := app.contextGetUser(r)
+
 	// Accept the metadata struct as a return value.
-	tasks, metadata, err := app.models.Tasks.GetAll(input.Title, input.Filters)
+	tasks, metadata, err := app.models.Tasks.GetAll(input.TaskQuery, user.ID, input.Filters)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", "must be a cursor returned as next_cursor")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
+	if render {
+		renderDescriptions(tasks...)
+	}
+
+	// In cursor mode, also link to the first and next pages in the headers.
+	var headers http.Header
+	if input.Filters.UseCursor {
+		headers = app.cursorLinks(r, metadata)
+	}
 
 	// Include the metadata in the response envelope.
-	err = app.writeJSON(w, http.StatusOK, envelope{"tasks": tasks, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"tasks": tasks, "metadata": metadata}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// The readTaskListing() helper reads the parameters for a list of tasks from the query
+// string: the filters, read by readTaskQuery(), and the sort and pagination. All of them
+// are validated, with any errors recorded in the validator.
+func (app *application) readTaskListing(qs url.Values, v *validator.Validator) (data.TaskQuery, data.Filters) {
+	var filters data.Filters
+
+	// Read the filters on the tasks which are listed.
+	q := app.readTaskQuery(qs, v)
+
+	// Read the page and page_size query string values into the Filters struct.
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Including the cursor parameter, even with an empty value for the first page,
+	// switches to cursor mode, which pages by position instead of page number.
+	if qs.Has("cursor") {
+		filters.UseCursor = true
+		filters.Cursor = qs.Get("cursor")
+		v.Check(!qs.Has("page"), "page", "must not be used together with cursor")
+	}
+
+	// Read the sort query string value. Searches for words or phrases are sorted with
+	// the best matches first, unless another order is asked for.
+	defaultSort := "id"
+	if q.Title != "" || q.Search.HasText() {
+		defaultSort = "relevance"
+	}
+	filters.Sort = app.readString(qs, "sort", defaultSort)
+
+	// Add the supported sort values for this endpoint to the sort safelist. Several of
+	// them can be combined, as in sort=-priority,due_date.
+	filters.SortSafelist = []string{"id", "title", "priority", "status", "category", "due_date", "created_at", "relevance",
+		"-id", "-title", "-priority", "-status", "-category", "-due_date", "-created_at", "-relevance"}
+
+	// Execute the validation checks on the query and the Filters struct.
+	data.ValidateTaskQuery(v, q)
+	data.ValidateFilters(v, filters)
+	return q, filters
+}
+
+// The readTaskQuery() helper reads the filters for a list of tasks from the query string.
+// Filters which take several values accept them as a comma-separated list, and match tasks
+// which have any of them. Values which can't be parsed are recorded in the validator, and
+// the caller should check the rest with data.ValidateTaskQuery().
+func (app *application) readTaskQuery(qs url.Values, v *validator.Validator) data.TaskQuery {
+	var q data.TaskQuery
+	q.Title = app.readString(qs, "title", "")
+
+	// Read the comma-separated tags to filter by, and whether tasks need to carry any or
+	// all of them. Repeated tags are dropped so that they don't throw off the "all" mode.
+	q.Tags = data.NormalizeTags(app.readCSV(qs, "tags", []string{}))
+	q.Tags = slices.Compact(q.Tags)
+	q.TagsMatch = app.readString(qs, "tags_mode", data.TagsMatchAny)
+
+	// Tasks in archived projects are hidden, unless they're asked for explicitly or by
+	// listing the tasks of a specific project.
+	q.ProjectID = int64(app.readInt(qs, "project", 0, v))
+	q.IncludeArchived = app.readBool(qs, "include_archived", false, v) || q.ProjectID != 0
+
+	q.Statuses = app.readCSV(qs, "status", nil)
+	q.Priorities = app.readCSV(qs, "priority", nil)
+	q.Categories = app.readCSV(qs, "category", nil)
+	q.Owners = app.readIDs(qs, "owner", v)
+
+	q.DueAfter = app.readTime(qs, "due_after", time.Time{}, v)
+	q.DueBefore = app.readTime(qs, "due_before", time.Time{}, v)
+	q.CreatedAfter = app.readTime(qs, "created_after", time.Time{}, v)
+	q.CreatedBefore = app.readTime(qs, "created_before", time.Time{}, v)
+	q.Overdue = app.readBool(qs, "overdue", false, v)
+
+	// The q parameter holds a search in the query language, which combines with any of
+	// the other filters.
+	if s := app.readString(qs, "q", ""); s != "" {
+		search, err := data.ParseSearch(s)
+		if err != nil {
+			v.AddError("q", err.Error())
+		}
+		q.Search = search
+	}
+	return q
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+	"time"
+)
+
+// maxTimeReportDays is the longest range of dates that a time report can cover.
+const maxTimeReportDays = 366
+
+// The startTaskTimerHandler starts a timer for the user on a task. Each user can only have
+// one timer running, so if they already have one, on this task or another, it must be
+// stopped first.
+func (app *application) startTaskTimerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	entry, err := app.models.TimeEntries.StartTimer(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTimerRunning):
+			app.timerRunningResponse(w, r, user.ID)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"time_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// timerRunningResponse reports that the user already has a timer running, and which task
+// it's on.
+func (app *application) timerRunningResponse(w http.ResponseWriter, r *http.Request, userID int64) {
+	message := "you already have a timer running, stop it before starting another"
+	running, err := app.models.TimeEntries.GetRunning(userID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// The timer may have been stopped in the meantime, in which case the message is still
+	// true enough for the client to try again.
+	if running != nil {
+		message = fmt.Sprintf("you already have a timer running on task %d, stop it before starting another", running.TaskID)
+	}
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The stopTaskTimerHandler stops the timer that the user has running on a task. Only the
+// user's own timer is affected, so unlike starting a timer this doesn't need a role on the
+// task, and users can still stop a timer on a task which they've lost access to.
+func (app *application) stopTaskTimerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	entry, err := app.models.TimeEntries.StopTimer(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusConflict, "you don't have a timer running on this task")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"time_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showTimerHandler returns the timer that the user has running, whichever task it's
+// on, or a 404 Not Found response if they don't have one running.
+func (app *application) showTimerHandler(w http.ResponseWriter, r *http.Request) {
+	entry, err := app.models.TimeEntries.GetRunning(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"time_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTaskTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-started_at")
+	input.Filters.SortSafelist = []string{"id", "started_at", "-id", "-started_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	entries, metadata, err := app.models.TimeEntries.GetAllForTask(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"time_entries": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createTaskTimeEntryHandler adds an entry by hand, for time which wasn't tracked
+// with a timer. The entry is always recorded for the authenticated user.
+func (app *application) createTaskTimeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		StartedAt data.CustomTime  `json:"started_at"`
+		StoppedAt *data.CustomTime `json:"stopped_at"`
+		Note      string           `json:"note"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	entry := &data.TimeEntry{
+		TaskID:    id,
+		UserID:    app.contextGetUser(r).ID,
+		StartedAt: input.StartedAt,
+		StoppedAt: input.StoppedAt,
+		Note:      input.Note,
+	}
+	v := validator.New()
+	if data.ValidateTimeEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.TimeEntries.Insert(entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"time_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTaskTimeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	entryID, err := app.readNamedIDParam(r, "entry_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	entry, err := app.models.TimeEntries.Get(entryID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Users can delete their own entries, and anybody with the owner role on the task
+	// can delete everybody's, in the same way as comments.
+	user := app.contextGetUser(r)
+	if entry.UserID != user.ID {
+		role, _, err := app.models.Tasks.GetRole(entry.TaskID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.RoleIncludes(role, data.RoleOwner) {
+			app.notPermittedResponses(w, r)
+			return
+		}
+	}
+	err = app.models.TimeEntries.Delete(entry.ID, entry.TaskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "time entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showTimeReportHandler totals the time tracked on the tasks that the user can see,
+// between the from and to dates (both included), by day, by category and by user. The
+// report can be narrowed down to the tasks in one project with the project parameter, as
+// for GET /v1/tasks.
+func (app *application) showTimeReportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	var q data.TimeReportQuery
+	q.From = app.readTime(qs, "from", time.Time{}, v)
+	to := app.readTime(qs, "to", time.Time{}, v)
+	q.ProjectID = int64(app.readInt(qs, "project", 0, v))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	v.Check(q.ProjectID >= 0, "project", "must be a positive integer")
+	v.Check(!q.From.IsZero(), "from", "must be provided")
+	v.Check(!to.IsZero(), "to", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// The report covers whole days, so the times are dropped and the range runs up to
+	// the start of the day after to.
+	q.From = q.From.UTC().Truncate(24 * time.Hour)
+	q.To = to.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	v.Check(q.To.After(q.From), "to", "must not be before from")
+	v.Check(q.To.Sub(q.From) <= maxTimeReportDays*24*time.Hour, "to", fmt.Sprintf("must be no more than %d days after from", maxTimeReportDays-1))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	report, err := app.models.TimeEntries.Report(q, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tasks, metadata, err := app.models.Tasks.GetTrash(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tasks": tasks, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Trashed tasks are invisible to requireTaskPermission(), so Restore() checks that
+	// the user holds the owner role on the task itself.
+	task, err := app.models.Tasks.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrParentInTrash):
+			v := validator.New()
+			v.AddError("parent_id", "refers to a task in the trash, which must be restored first")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The runPurge() method permanently deletes the tasks which have been in the trash for
+// longer than the retention period, straight away and then every trash-purge-interval,
+// until ctx is cancelled. Like runReminders(), it should be started with app.background().
+func (app *application) runPurge(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+	for {
+		app.purgeTrash(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// The purgeTrash() method deletes the expired tasks and then the files that were attached
+// to them.
+func (app *application) purgeTrash(ctx context.Context) {
+	purged, keys, err := app.models.Tasks.Purge(time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, key := range keys {
+		err = app.storage.Delete(ctx, key)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"storage_key": key})
+		}
+	}
+	if purged > 0 {
+		app.logger.PrintInfo("purged trashed tasks", map[string]string{"count": strconv.FormatInt(purged, 10)})
+	}
+}
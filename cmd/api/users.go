@@ -13,6 +13,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Language string `json:"language"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -23,6 +24,12 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Language:  input.Language,
+	}
+	// Full-text search uses the simple configuration, which doesn't stem words, unless
+	// the user chooses a language.
+	if user.Language == "" {
+		user.Language = "simple"
 	}
 	err = user.Password.Set(input.Password)
 	if err != nil {
@@ -129,3 +136,43 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// The updateUserHandler updates the details of the authenticated user. Only the fields
+// which are included in the request body are changed.
+func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     *string `json:"name"`
+		Language *string `json:"language"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Language != nil {
+		user.Language = *input.Language
+	}
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
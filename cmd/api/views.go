@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/data"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/http"
+)
+
+func (app *application) createViewHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string           `json:"name"`
+		Filters data.ViewFilters `json:"filters"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// The view is owned by the user creating it.
+	view := &data.View{
+		Name:    input.Name,
+		Filters: input.Filters,
+		UserID:  app.contextGetUser(r).ID,
+	}
+	if view.Filters == nil {
+		view.Filters = data.ViewFilters{}
+	}
+	v := validator.New()
+	data.ValidateView(v, view)
+	if app.validateViewFilters(v, view.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Views.Insert(view)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/views/%d", view.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"view": view}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listViewsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Views which have been shared with the user are listed along with their own.
+	views, metadata, err := app.models.Views.GetAll(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"views": views, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showViewHandler(w http.ResponseWriter, r *http.Request) {
+	view, err := app.readView(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"view": view}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateViewHandler(w http.ResponseWriter, r *http.Request) {
+	view, err := app.readView(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The filters are replaced as a whole, rather than merged with the saved ones.
+	var input struct {
+		Name    *string           `json:"name"`
+		Filters *data.ViewFilters `json:"filters"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		view.Name = *input.Name
+	}
+	if input.Filters != nil {
+		view.Filters = *input.Filters
+		if view.Filters == nil {
+			view.Filters = data.ViewFilters{}
+		}
+	}
+	v := validator.New()
+	data.ValidateView(v, view)
+	if app.validateViewFilters(v, view.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Views.Update(view)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"view": view}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteViewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Views.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "view successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showViewTasksHandler runs a view, listing the tasks which match its filters in the
+// same way as GET /v1/tasks. The tasks are those that the user running the view can see
+// now, so a view which has been shared never shows anybody tasks that they couldn't list
+// themselves. Only the pagination, and whether to render the task descriptions as HTML, are
+// taken from the query string.
+func (app *application) showViewTasksHandler(w http.ResponseWriter, r *http.Request) {
+	view, err := app.readView(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	qs := view.Filters.Values()
+	for _, key := range []string{"page", "page_size", "cursor", "render"} {
+		if values, ok := r.URL.Query()[key]; ok {
+			qs[key] = values
+		}
+	}
+	app.listTasks(w, r, qs)
+}
+
+func (app *application) listViewSharesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	shares, err := app.models.ViewShares.GetAllForView(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"shares": shares}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) shareViewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Views are shared by email address, in the same way as tasks and projects, and
+	// always read-only.
+	var input struct {
+		Email string `json:"email"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.ID == app.contextGetUser(r).ID {
+		v.AddError("email", "this user already owns the view")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	share := &data.ViewShare{
+		ViewID: id,
+		UserID: user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+	}
+	err = app.models.ViewShares.Insert(share)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"share": share}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unshareViewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// The owner can stop sharing a view with anybody, and every user that a view has been
+	// shared with can remove it from their own list.
+	user := app.contextGetUser(r)
+	if userID != user.ID {
+		role, _, err := app.models.Views.GetRole(id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.RoleIncludes(role, data.RoleOwner) {
+			app.notPermittedResponses(w, r)
+			return
+		}
+	}
+	err = app.models.ViewShares.Delete(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "view successfully unshared"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readView returns the view named by the "id" URL parameter, if the user can see it.
+func (app *application) readView(r *http.Request) (*data.View, error) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+	return app.models.Views.Get(id, app.contextGetUser(r).ID)
+}
+
+// validateViewFilters checks the values of the filters saved in a view in the same way as
+// they're checked when listing tasks, so that a view can always be run. Any errors are
+// recorded against "filters." followed by the name of the parameter.
+func (app *application) validateViewFilters(v *validator.Validator, filters data.ViewFilters) {
+	fv := validator.New()
+	app.readTaskListing(filters.Values(), fv)
+	for key, message := range fv.Errors {
+		v.AddError("filters."+key, message)
+	}
+}
@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"time"
+)
+
+// Attachment holds the metadata for a file attached to a task. The contents of the file
+// live in the storage backend under StorageKey, which is never sent to clients.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	TaskID      int64     `json:"task_id"`
+	UserID      int64     `json:"user_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	StorageKey  string    `json:"-"`
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.Filename != "", "file", "must have a filename")
+	v.Check(len(attachment.Filename) <= 255, "file", "must have a filename of not more than 255 bytes")
+	v.Check(attachment.ContentType != "", "file", "must have a content type")
+}
+
+// Define the AttachmentModel type.
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+const attachmentColumns = `id, created_at, task_id, user_id, filename, content_type, size, sha256, storage_key`
+
+func attachmentFields(attachment *Attachment) []interface{} {
+	return []interface{}{
+		&attachment.ID,
+		&attachment.CreatedAt,
+		&attachment.TaskID,
+		&attachment.UserID,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.SHA256,
+		&attachment.StorageKey,
+	}
+}
+
+// Insert records the metadata for a file which has already been written to storage.
+func (m AttachmentModel) Insert(attachment *Attachment) error {
+	query := `
+		INSERT INTO task_attachments (task_id, user_id, filename, content_type, size, sha256, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+	args := []interface{}{
+		attachment.TaskID,
+		attachment.UserID,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.SHA256,
+		attachment.StorageKey,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+}
+
+// Get returns a specific attachment on a specific task.
+func (m AttachmentModel) Get(id, taskID int64) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM task_attachments
+		WHERE id = $1 AND task_id = $2`
+	var attachment Attachment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, taskID).Scan(attachmentFields(&attachment)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &attachment, nil
+}
+
+// GetAllForTask returns the attachments on a task, in the order they were uploaded.
+func (m AttachmentModel) GetAllForTask(taskID int64) ([]*Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM task_attachments
+		WHERE task_id = $1
+		ORDER BY created_at, id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []*Attachment{}
+	for rows.Next() {
+		var attachment Attachment
+		err := rows.Scan(attachmentFields(&attachment)...)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &attachment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// TotalSizeForUser returns the combined size in bytes of every file the user has uploaded,
+// which is checked against the per-user quota.
+func (m AttachmentModel) TotalSizeForUser(userID int64) (int64, error) {
+	query := `
+		SELECT COALESCE(SUM(size), 0)
+		FROM task_attachments
+		WHERE user_id = $1`
+	var total int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&total)
+	return total, err
+}
+
+// Delete removes the metadata for an attachment. Removing the file itself from storage is
+// left to the caller.
+func (m AttachmentModel) Delete(id, taskID int64) error {
+	query := `
+		DELETE FROM task_attachments
+		WHERE id = $1 AND task_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, taskID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"strings"
+	"time"
+)
+
+// Define constants for the roles that a user can hold on a task. The owner of a task
+// always holds RoleOwner on it; everybody else gets their role from the
+// task_collaborators table.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// Roles lists the valid roles, from the least to the most privileged.
+var Roles = []string{RoleViewer, RoleEditor, RoleOwner}
+
+// maxProjectTaskRole is the highest role that a user gets on the tasks in a project from
+// their role on the project, even if they own it. Deleting a task and sharing it with
+// others are left to the owner of the task and the collaborators they make owners.
+const maxProjectTaskRole = RoleEditor
+
+// RoleIncludes reports whether the role grants at least the access of the required role.
+// An owner can do everything an editor can, and an editor everything a viewer can.
+func RoleIncludes(role, required string) bool {
+	return roleRank(role) >= roleRank(required) && roleRank(role) > 0
+}
+
+func roleRank(role string) int {
+	for i := range Roles {
+		if Roles[i] == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// rolesIncluding returns a quoted, comma-separated list of every role which includes the
+// required role, ready to be used in an SQL IN (...) clause.
+func rolesIncluding(required string) string {
+	var roles []string
+	for _, role := range Roles {
+		if RoleIncludes(role, required) {
+			roles = append(roles, "'"+role+"'")
+		}
+	}
+	return strings.Join(roles, ", ")
+}
+
+// taskAccessCondition returns an SQL condition which holds for the tasks on which the user
+// whose ID is bound to the given placeholder holds at least the required role, either
+// by owning the task, by having been added as a collaborator, or through their role on
+// the project that the task belongs to, which gives at most maxProjectTaskRole.
+func taskAccessCondition(placeholder, required string) string {
+	condition := fmt.Sprintf(`tasks.user_id = %[1]s OR EXISTS (
+				SELECT 1 FROM task_collaborators
+				WHERE task_collaborators.task_id = tasks.id
+				AND task_collaborators.user_id = %[1]s
+				AND task_collaborators.role IN (%[2]s))`, placeholder, rolesIncluding(required))
+	if RoleIncludes(maxProjectTaskRole, required) {
+		condition += fmt.Sprintf(` OR EXISTS (
+				SELECT 1 FROM projects
+				WHERE projects.id = tasks.project_id
+				AND %s)`, projectAccessCondition(placeholder, required))
+	}
+	return "(" + condition + ")"
+}
+
+// Collaborator represents a user who has been given access to somebody else's task.
+type Collaborator struct {
+	TaskID    int64     `json:"task_id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateCollaborator(v *validator.Validator, collaborator *Collaborator) {
+	v.Check(collaborator.Role != "", "role", "must be provided")
+	v.Check(validator.In(collaborator.Role, Roles...), "role", "must be one of viewer, editor or owner")
+}
+
+// Define the CollaboratorModel type.
+type CollaboratorModel struct {
+	DB *sql.DB
+}
+
+// Insert adds the user as a collaborator on the task. If the user is already a
+// collaborator their role is replaced with the new one.
+func (m CollaboratorModel) Insert(collaborator *Collaborator) error {
+	query := `
+		INSERT INTO task_collaborators (task_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (task_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at`
+	args := []interface{}{collaborator.TaskID, collaborator.UserID, collaborator.Role}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&collaborator.CreatedAt)
+}
+
+// GetAllForTask returns the collaborators on a specific task, in the order they were added.
+func (m CollaboratorModel) GetAllForTask(taskID int64) ([]*Collaborator, error) {
+	query := `
+		SELECT task_collaborators.task_id, users.id, users.name, users.email, task_collaborators.role, task_collaborators.created_at
+		FROM task_collaborators
+		INNER JOIN users ON users.id = task_collaborators.user_id
+		WHERE task_collaborators.task_id = $1
+		ORDER BY task_collaborators.created_at, users.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	collaborators := []*Collaborator{}
+	for rows.Next() {
+		var collaborator Collaborator
+		err := rows.Scan(
+			&collaborator.TaskID,
+			&collaborator.UserID,
+			&collaborator.Name,
+			&collaborator.Email,
+			&collaborator.Role,
+			&collaborator.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		collaborators = append(collaborators, &collaborator)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return collaborators, nil
+}
+
+// Delete removes a user from the collaborators on a task, returning ErrRecordNotFound
+// if they weren't a collaborator in the first place.
+func (m CollaboratorModel) Delete(taskID, userID int64) error {
+	query := `
+		DELETE FROM task_collaborators
+		WHERE task_id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, taskID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetRole returns the role that the user holds on a specific task, and whether they are
+// the owner of the task (as opposed to a collaborator who was granted RoleOwner). A user
+// who is both a collaborator on the task and a member of its project gets the higher of
+// the two roles, where the role from the project is capped at maxProjectTaskRole. If the
+// user has no access to the task at all, ErrRecordNotFound is returned.
+func (m TaskModel) GetRole(id, userID int64) (string, bool, error) {
+	if id < 1 {
+		return "", false, ErrRecordNotFound
+	}
+	query := `
+		SELECT tasks.user_id = $2,
+			(SELECT role FROM task_collaborators
+				WHERE task_collaborators.task_id = tasks.id AND task_collaborators.user_id = $2),
+			(SELECT CASE WHEN projects.user_id = $2 THEN 'owner' ELSE project_members.role END
+				FROM projects
+				LEFT JOIN project_members ON project_members.project_id = projects.id AND project_members.user_id = $2
+				WHERE projects.id = tasks.project_id)
+		FROM tasks
+		WHERE tasks.id = $1 AND tasks.deleted_at IS NULL`
+	var (
+		owner       bool
+		taskRole    sql.NullString
+		projectRole sql.NullString
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.db().QueryRowContext(ctx, query, id, userID).Scan(&owner, &taskRole, &projectRole)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", false, ErrRecordNotFound
+		default:
+			return "", false, err
+		}
+	}
+	if owner {
+		return RoleOwner, true, nil
+	}
+	role := taskRole.String
+	if roleRank(projectRole.String) > roleRank(maxProjectTaskRole) {
+		projectRole.String = maxProjectTaskRole
+	}
+	if roleRank(projectRole.String) > roleRank(role) {
+		role = projectRole.String
+	}
+	if role == "" {
+		return "", false, ErrRecordNotFound
+	}
+	return role, false, nil
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Comment is a comment on a task. Comments can have one level of replies: a reply has
+// the ID of the comment it answers in ParentID, and can't be replied to itself.
+type Comment struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	TaskID     int64      `json:"task_id"`
+	UserID     int64      `json:"user_id"`
+	AuthorName string     `json:"author_name"`
+	ParentID   *int64     `json:"parent_id,omitempty"`
+	Body       string     `json:"body"`
+	Version    int32      `json:"version"`
+	Replies    []*Comment `json:"replies,omitempty"`
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+}
+
+// Define the CommentModel type.
+type CommentModel struct {
+	DB *sql.DB
+}
+
+const commentColumns = `task_comments.id, task_comments.created_at, task_comments.updated_at, task_comments.task_id,
+		task_comments.user_id, users.name, task_comments.parent_id, task_comments.body, task_comments.version`
+
+func commentFields(comment *Comment) []interface{} {
+	return []interface{}{
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.TaskID,
+		&comment.UserID,
+		&comment.AuthorName,
+		&comment.ParentID,
+		&comment.Body,
+		&comment.Version,
+	}
+}
+
+// Insert adds a new comment to a task. The caller is expected to have checked that the
+// comment being replied to, if any, is a top-level comment on the same task.
+func (m CommentModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO task_comments (task_id, user_id, parent_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+	args := []interface{}{comment.TaskID, comment.UserID, comment.ParentID, comment.Body}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
+}
+
+// Get returns a specific comment on a specific task.
+func (m CommentModel) Get(id, taskID int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + commentColumns + `
+		FROM task_comments
+		INNER JOIN users ON users.id = task_comments.user_id
+		WHERE task_comments.id = $1 AND task_comments.task_id = $2`
+	var comment Comment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, taskID).Scan(commentFields(&comment)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &comment, nil
+}
+
+// GetAllForTask returns a page of the top-level comments on a task, each with all of
+// its replies in the order they were made.
+func (m CommentModel) GetAllForTask(taskID int64, filters Filters) ([]*Comment, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM task_comments
+		INNER JOIN users ON users.id = task_comments.user_id
+		WHERE task_comments.task_id = $1 AND task_comments.parent_id IS NULL
+		ORDER BY %s, task_comments.id ASC
+		LIMIT $2 OFFSET $3`, commentColumns, filters.orderBy("task_comments"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, taskID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	comments := []*Comment{}
+	byID := make(map[int64]*Comment)
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(append([]interface{}{&totalRecords}, commentFields(&comment)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		comments = append(comments, &comment)
+		byID[comment.ID] = &comment
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Fetch the replies to the comments on this page in a single query.
+	ids := make([]int64, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].ID
+	}
+	query = `
+		SELECT ` + commentColumns + `
+		FROM task_comments
+		INNER JOIN users ON users.id = task_comments.user_id
+		WHERE task_comments.parent_id = ANY($1)
+		ORDER BY task_comments.created_at, task_comments.id`
+	replies, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer replies.Close()
+	for replies.Next() {
+		var reply Comment
+		err := replies.Scan(commentFields(&reply)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		parent := byID[*reply.ParentID]
+		parent.Replies = append(parent.Replies, &reply)
+	}
+	if err = replies.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return comments, metadata, nil
+}
+
+// Update changes the body of a comment, using the version number in the same way as
+// TaskModel.Update() to detect edit conflicts.
+func (m CommentModel) Update(comment *Comment) error {
+	query := `
+		UPDATE task_comments
+		SET body = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING updated_at, version`
+	args := []interface{}{comment.Body, comment.ID, comment.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.UpdatedAt, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a comment, along with any replies to it.
+func (m CommentModel) Delete(id, taskID int64) error {
+	query := `
+		DELETE FROM task_comments
+		WHERE id = $1 AND task_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, taskID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
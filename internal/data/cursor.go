@@ -0,0 +1,124 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// Define a custom ErrInvalidCursor error, returned by GetAll() when the values in a cursor
+// can't be compared with the keys that the tasks are sorted by.
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// cursor is the position of the last row on a page of results in cursor mode. It holds
+// the values of the sort keys for that row, as text, followed by its ID, which breaks any
+// ties. Clients only ever see it encoded by String(), and should treat it as opaque.
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     int64    `json:"id"`
+}
+
+// String encodes the cursor for use in a URL.
+func (c cursor) String() string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		// A cursor only holds strings and an integer, so it can always be marshalled.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// parseCursor decodes a cursor which was encoded by String(), checking that it was
+// issued for a page of results with the given sort.
+func parseCursor(s, sort string) (cursor, error) {
+	var c cursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("must be a cursor returned as next_cursor")
+	}
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return c, errors.New("must be a cursor returned as next_cursor")
+	}
+	if c.Sort != sort {
+		return c, errors.New("was returned for a different sort, so it can't be used with this one")
+	}
+	// A cursor for the same sort always has a value for each key.
+	if len(c.Values) != len(strings.Split(sort, ",")) {
+		return c, errors.New("must be a cursor returned as next_cursor")
+	}
+	return c, nil
+}
+
+// cursorQueryError returns ErrInvalidCursor in place of an error from a query which
+// carries on from a cursor, if PostgreSQL couldn't convert one of the values in the
+// cursor to the type of its sort key. The values are sent as text, so a client which
+// edits a cursor can put anything in them, such as "tomorrow" for a due date. Any other
+// error is returned as it is.
+func cursorQueryError(err error) error {
+	var pqErr *pq.Error
+	// Class 22 covers the data exceptions, such as invalid_datetime_format and
+	// invalid_text_representation.
+	if errors.As(err, &pqErr) && pqErr.Code.Class() == "22" {
+		return ErrInvalidCursor
+	}
+	return err
+}
+
+// sortKey is an expression that rows are sorted by, in ascending order unless desc is
+// set. The expression must not be NULL for any row.
+type sortKey struct {
+	expr string
+	desc bool
+}
+
+// orderByClause returns the keys as the contents of an ORDER BY clause.
+func orderByClause(keys []sortKey) string {
+	clauses := make([]string, len(keys))
+	for i, key := range keys {
+		clauses[i] = key.expr + " ASC"
+		if key.desc {
+			clauses[i] = key.expr + " DESC"
+		}
+	}
+	return strings.Join(clauses, ", ")
+}
+
+// keysetCondition returns the condition matching the rows which come after the cursor
+// when sorted by the keys and then by ascending ID. It is the expanded form of a row
+// comparison such as (a, b, id) > (x, y, z), which can't be used directly as the keys may
+// not all be sorted in the same direction.
+func keysetCondition(where *sqlConditions, keys []sortKey, c cursor) string {
+	// parseCursor() checks that there is a value for each key, but if there isn't, the
+	// client gets an empty page rather than a panic.
+	if len(c.Values) != len(keys) {
+		return "FALSE"
+	}
+	keys = append(keys, sortKey{expr: "tasks.id"})
+	values := make([]string, len(keys))
+	for i := range keys[:len(keys)-1] {
+		values[i] = where.arg(c.Values[i])
+	}
+	values[len(keys)-1] = where.arg(c.ID)
+
+	var alternatives []string
+	for i, key := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("%s = %s", keys[j].expr, values[j]))
+		}
+		op := ">"
+		if key.desc {
+			op = "<"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", key.expr, op, values[i]))
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(alternatives, " OR ")
+}
@@ -0,0 +1,183 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"github.com/lib/pq"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := cursor{Sort: "-priority,due_date", Values: []string{"3", "2024-01-02 03:04:05+00"}, ID: 42}
+	s := c.String()
+	if strings.ContainsAny(s, "+/=") {
+		t.Errorf("String() = %q, which isn't safe to use in a URL as it is", s)
+	}
+	got, err := parseCursor(s, c.Sort)
+	if err != nil {
+		t.Fatalf("parseCursor(%q) returned error: %v", s, err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("parseCursor(%q) = %+v, want %+v", s, got, c)
+	}
+}
+
+func TestParseCursorErrors(t *testing.T) {
+	encode := func(js string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(js))
+	}
+	tests := []struct {
+		name    string
+		cursor  string
+		sort    string
+		message string
+	}{
+		{
+			name:    "not base64",
+			cursor:  "not a cursor!",
+			sort:    "id",
+			message: "must be a cursor returned as next_cursor",
+		},
+		{
+			name:    "not JSON",
+			cursor:  encode("garbage"),
+			sort:    "id",
+			message: "must be a cursor returned as next_cursor",
+		},
+		{
+			name:    "wrong types",
+			cursor:  encode(`{"s":"id","v":[1],"id":"1"}`),
+			sort:    "id",
+			message: "must be a cursor returned as next_cursor",
+		},
+		{
+			name:    "no ID",
+			cursor:  encode(`{"s":"id","v":["1"]}`),
+			sort:    "id",
+			message: "must be a cursor returned as next_cursor",
+		},
+		{
+			name:    "negative ID",
+			cursor:  encode(`{"s":"id","v":["1"],"id":-1}`),
+			sort:    "id",
+			message: "must be a cursor returned as next_cursor",
+		},
+		{
+			name:    "different sort",
+			cursor:  cursor{Sort: "id", Values: []string{"1"}, ID: 1}.String(),
+			sort:    "-id",
+			message: "was returned for a different sort",
+		},
+		{
+			name:    "too few values",
+			cursor:  cursor{Sort: "title,-due_date", Values: []string{"a"}, ID: 1}.String(),
+			sort:    "title,-due_date",
+			message: "must be a cursor returned as next_cursor",
+		},
+		{
+			name:    "too many values",
+			cursor:  cursor{Sort: "title", Values: []string{"a", "b"}, ID: 1}.String(),
+			sort:    "title",
+			message: "must be a cursor returned as next_cursor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCursor(tt.cursor, tt.sort)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("parseCursor(%q) error = %v, want one containing %q", tt.cursor, err, tt.message)
+			}
+			// The same problem is reported by ValidateFilters(), so that the client gets
+			// a 422 response rather than an error from the database.
+			v := validator.New()
+			ValidateFilters(v, Filters{Page: 1, PageSize: 20, Sort: tt.sort, SortSafelist: strings.Split(tt.sort, ","), UseCursor: true, Cursor: tt.cursor})
+			if v.Errors["cursor"] == "" {
+				t.Errorf("ValidateFilters() errors = %v, want one for cursor", v.Errors)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  []sortKey
+		c     cursor
+		where string
+		args  []interface{}
+	}{
+		{
+			name:  "ID only",
+			keys:  nil,
+			c:     cursor{ID: 7},
+			where: "(tasks.id > $1)",
+			args:  []interface{}{int64(7)},
+		},
+		{
+			name:  "one key",
+			keys:  []sortKey{{expr: "tasks.title"}},
+			c:     cursor{Values: []string{"b"}, ID: 7},
+			where: "(tasks.title > $1) OR (tasks.title = $1 AND tasks.id > $2)",
+			args:  []interface{}{"b", int64(7)},
+		},
+		{
+			name: "mixed directions",
+			keys: []sortKey{{expr: "tasks.priority", desc: true}, {expr: "tasks.due_date"}, {expr: "tasks.category", desc: true}},
+			c:    cursor{Values: []string{"3", "2024-01-02", "work"}, ID: 7},
+			where: "(tasks.priority < $1) OR " +
+				"(tasks.priority = $1 AND tasks.due_date > $2) OR " +
+				"(tasks.priority = $1 AND tasks.due_date = $2 AND tasks.category < $3) OR " +
+				"(tasks.priority = $1 AND tasks.due_date = $2 AND tasks.category = $3 AND tasks.id > $4)",
+			args: []interface{}{"3", "2024-01-02", "work", int64(7)},
+		},
+		{
+			name:  "missing values",
+			keys:  []sortKey{{expr: "tasks.title"}, {expr: "tasks.category"}},
+			c:     cursor{Values: []string{"b"}, ID: 7},
+			where: "FALSE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var where sqlConditions
+			if got := keysetCondition(&where, tt.keys, tt.c); got != tt.where {
+				t.Errorf("keysetCondition() = %q, want %q", got, tt.where)
+			}
+			if !reflect.DeepEqual(where.args, tt.args) {
+				t.Errorf("args = %#v, want %#v", where.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestOrderByClause(t *testing.T) {
+	keys := []sortKey{{expr: "tasks.priority", desc: true}, {expr: "tasks.due_date"}}
+	want := "tasks.priority DESC, tasks.due_date ASC"
+	if got := orderByClause(keys); got != want {
+		t.Errorf("orderByClause() = %q, want %q", got, want)
+	}
+}
+
+func TestCursorQueryError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{err: &pq.Error{Code: "22007"}, want: ErrInvalidCursor},
+		{err: &pq.Error{Code: "22P02"}, want: ErrInvalidCursor},
+		{err: &pq.Error{Code: "57014"}},
+		{err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want == nil {
+			want = tt.err
+		}
+		if got := cursorQueryError(tt.err); got != want {
+			t.Errorf("cursorQueryError(%v) = %v, want %v", tt.err, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Define a custom ErrDependencyCycle error, returned when adding a dependency would make
+// a task (indirectly) block itself.
+var (
+	ErrDependencyCycle = errors.New("dependency cycle")
+)
+
+// TaskRef is a short summary of a task, used when listing the tasks that a task is
+// blocked by or is blocking.
+type TaskRef struct {
+	ID     int64  `json:"id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+}
+
+// Define the DependencyModel type. A dependency records that the task with ID task_id
+// can't be completed until the task with ID blocked_by_id is.
+type DependencyModel struct {
+	DB *sql.DB
+}
+
+// Insert records that the task with ID taskID is blocked by the task with ID blockedByID.
+// If the blocking task is already (directly or indirectly) blocked by taskID, the new
+// dependency would create a cycle and ErrDependencyCycle is returned instead. Adding a
+// dependency which already exists is not an error.
+func (m DependencyModel) Insert(taskID, blockedByID int64) error {
+	if taskID == blockedByID {
+		return ErrDependencyCycle
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Lock the table against concurrent writes, so that two requests can't each add one
+	// half of a cycle after checking that the other half doesn't exist yet.
+	_, err = tx.ExecContext(ctx, `LOCK TABLE task_dependencies IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+	// Walk everything that the blocking task is waiting for. If that includes taskID, then
+	// taskID would end up waiting for itself.
+	query := `
+		WITH RECURSIVE blockers (id) AS (
+			SELECT blocked_by_id FROM task_dependencies WHERE task_id = $1
+			UNION
+			SELECT task_dependencies.blocked_by_id
+			FROM task_dependencies
+			INNER JOIN blockers ON task_dependencies.task_id = blockers.id
+		)
+		SELECT EXISTS (SELECT 1 FROM blockers WHERE id = $2)`
+	var cycle bool
+	err = tx.QueryRowContext(ctx, query, blockedByID, taskID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrDependencyCycle
+	}
+	query = `
+		INSERT INTO task_dependencies (task_id, blocked_by_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+	_, err = tx.ExecContext(ctx, query, taskID, blockedByID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes a dependency, returning ErrRecordNotFound if it didn't exist.
+func (m DependencyModel) Delete(taskID, blockedByID int64) error {
+	query := `
+		DELETE FROM task_dependencies
+		WHERE task_id = $1 AND blocked_by_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, taskID, blockedByID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetBlockedBy returns the tasks that the task with the given ID is waiting for. Only the
+// tasks that the user can see are returned, since the other end of a dependency may be
+// somebody else's task.
+func (m DependencyModel) GetBlockedBy(taskID, userID int64) ([]TaskRef, error) {
+	query := `
+		SELECT tasks.id, tasks.title, tasks.status
+		FROM task_dependencies
+		INNER JOIN tasks ON tasks.id = task_dependencies.blocked_by_id
+		WHERE task_dependencies.task_id = $1 AND tasks.deleted_at IS NULL
+		AND ` + taskAccessCondition("$2", RoleViewer) + `
+		ORDER BY tasks.id`
+	return m.getRefs(query, taskID, userID)
+}
+
+// GetBlocking returns the tasks which are waiting for the task with the given ID, out of
+// those that the user can see.
+func (m DependencyModel) GetBlocking(taskID, userID int64) ([]TaskRef, error) {
+	query := `
+		SELECT tasks.id, tasks.title, tasks.status
+		FROM task_dependencies
+		INNER JOIN tasks ON tasks.id = task_dependencies.task_id
+		WHERE task_dependencies.blocked_by_id = $1 AND tasks.deleted_at IS NULL
+		AND ` + taskAccessCondition("$2", RoleViewer) + `
+		ORDER BY tasks.id`
+	return m.getRefs(query, taskID, userID)
+}
+
+func (m DependencyModel) getRefs(query string, taskID, userID int64) ([]TaskRef, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	refs := []TaskRef{}
+	for rows.Next() {
+		var ref TaskRef
+		err := rows.Scan(&ref.ID, &ref.Title, &ref.Status)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// OpenBlockers returns the IDs of the tasks which the task with the given ID is waiting
+// for and which aren't completed yet, out of those that the user can see, along with the
+// number of others that the user can't see. A task can't be completed while any of them
+// are open, whether or not the user can see them.
+func (m TaskModel) OpenBlockers(id, userID int64) ([]int64, int, error) {
+	query := `
+		SELECT tasks.id, ` + taskAccessCondition("$2", RoleViewer) + `
+		FROM task_dependencies
+		INNER JOIN tasks ON tasks.id = task_dependencies.blocked_by_id
+		WHERE task_dependencies.task_id = $1 AND tasks.deleted_at IS NULL AND tasks.status <> $3
+		ORDER BY tasks.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.db().QueryContext(ctx, query, id, userID, StatusCompleted)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var (
+		visible []int64
+		hidden  int
+	)
+	for rows.Next() {
+		var (
+			blockerID int64
+			canSee    bool
+		)
+		err := rows.Scan(&blockerID, &canSee)
+		if err != nil {
+			return nil, 0, err
+		}
+		if canSee {
+			visible = append(visible, blockerID)
+		} else {
+			hidden++
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return visible, hidden, nil
+}
@@ -12,6 +12,11 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// In cursor mode, pages are fetched by the position of the last row on the previous
+	// page rather than by page number, and the total count is skipped. An empty Cursor
+	// asks for the first page. Only GetAll() for tasks supports cursor mode.
+	UseCursor bool
+	Cursor    string
 }
 
 // Define a new Metadata struct for holding the pagination metadata.
@@ -21,6 +26,8 @@ type Metadata struct {
 	FirstPage    int `json:"first_page,omitempty"`
 	LastPage     int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+	// The cursor for the next page in cursor mode, or empty if this is the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // The calculateMetadata() function calculates the appropriate pagination metadata values given the total number of records,
@@ -46,23 +53,28 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
-// Check that the client-provided Sort field matches one of the entries in our safelist and if it does,
-// extract the column name from the Sort field by stripping the leading hyphen character (if one exists).
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+// Return the sort keys in the comma-separated Sort field, such as "-priority,due_date".
+// Each key is checked against our safelist, and then split into the column name, by
+// stripping the leading hyphen character (if one exists), and the direction to sort in.
+func (f Filters) sortKeys() []sortKey {
+	var keys []sortKey
+	for _, key := range strings.Split(f.Sort, ",") {
+		if !validator.In(key, f.SortSafelist...) {
+			panic("unsafe sort parameter: " + key)
 		}
+		keys = append(keys, sortKey{expr: strings.TrimPrefix(key, "-"), desc: strings.HasPrefix(key, "-")})
 	}
-	panic("unsafe sort parameter: " + f.Sort)
+	return keys
 }
 
-// Return the sort direction ("ASC" or "DESC") depending on the prefix character of the Sort field.
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+// Return the sort keys as the contents of an ORDER BY clause, with each column qualified
+// by the table name, such as "tasks.priority DESC, tasks.due_date ASC".
+func (f Filters) orderBy(table string) string {
+	keys := f.sortKeys()
+	for i := range keys {
+		keys[i].expr = table + "." + keys[i].expr
 	}
-	return "ASC"
+	return orderByClause(keys)
 }
 
 func (f Filters) limit() int {
@@ -78,6 +90,21 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	// Check that the sort parameter matches a value in the safelist.
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	// Check that each of the keys in the sort parameter matches a value in the safelist,
+	// and that no column is sorted by twice.
+	keys := strings.Split(f.Sort, ",")
+	v.Check(len(keys) <= 5, "sort", "must not contain more than 5 keys")
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		v.Check(validator.In(key, f.SortSafelist...), "sort", "invalid sort value")
+		columns[i] = strings.TrimPrefix(key, "-")
+	}
+	v.Check(validator.Unique(columns), "sort", "must not contain the same key more than once")
+	// Check that the cursor can be decoded, and was issued for the same sort.
+	if f.UseCursor && f.Cursor != "" {
+		_, err := parseCursor(f.Cursor, f.Sort)
+		if err != nil {
+			v.AddError("cursor", err.Error())
+		}
+	}
 }
@@ -0,0 +1,228 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Define constants for the actions recorded in the history of a task.
+const (
+	HistoryCreate  = "create"
+	HistoryUpdate  = "update"
+	HistoryDelete  = "delete"
+	HistoryRestore = "restore"
+)
+
+// HistoryEntry records a change made to a task: who made it, when, and the values of the
+// fields before and after. UserID is nil if the user has since been deleted.
+type HistoryEntry struct {
+	ID        int64                  `json:"id"`
+	CreatedAt time.Time              `json:"created_at"`
+	TaskID    int64                  `json:"task_id"`
+	UserID    *int64                 `json:"user_id"`
+	UserName  *string                `json:"user_name"`
+	Action    string                 `json:"action"`
+	Version   int32                  `json:"version"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// FieldChange holds the JSON values of a field before and after a change. From is null
+// for a newly created task, and To is null for a deleted one.
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// historyIgnoredFields lists the fields of a task which aren't worth recording, because
+// they can't be edited or are derived from other data.
+var historyIgnoredFields = map[string]bool{
+	"id":                 true,
+	"created_at":         true,
+	"updated_at":         true,
+	"ical_uid":           true,
+	"version":            true,
+	"progress":           true,
+	"time_spent_seconds": true,
+}
+
+// diffTasks compares two states of a task field by field, using their JSON encoding so
+// that every field of Task is covered without listing them here. Either state may be nil.
+func diffTasks(before, after *Task) (map[string]FieldChange, error) {
+	fieldsOf := func(task *Task) (map[string]json.RawMessage, error) {
+		fields := map[string]json.RawMessage{}
+		if task == nil {
+			return fields, nil
+		}
+		js, err := json.Marshal(task)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(js, &fields)
+		return fields, err
+	}
+	beforeFields, err := fieldsOf(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := fieldsOf(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]FieldChange{}
+	for _, fields := range []map[string]json.RawMessage{beforeFields, afterFields} {
+		for name := range fields {
+			if historyIgnoredFields[name] {
+				continue
+			}
+			from, to := beforeFields[name], afterFields[name]
+			if !bytes.Equal(from, to) {
+				changes[name] = FieldChange{From: from, To: to}
+			}
+		}
+	}
+	return changes, nil
+}
+
+// recordHistory adds an entry to the history of a task on the caller's transaction, so
+// that it is only kept if the change itself is committed.
+func recordHistory(ctx context.Context, tx querier, userID int64, action string, before, after *Task) error {
+	changes, err := diffTasks(before, after)
+	if err != nil {
+		return err
+	}
+	js, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	task := after
+	if task == nil {
+		task = before
+	}
+	query := `
+		INSERT INTO task_history (task_id, user_id, action, version, changes)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, query, task.ID, userID, action, task.Version, js)
+	return err
+}
+
+// getForUpdate reads the current state of a task on a transaction and locks its row until
+// the transaction ends, so that the state recorded in the history is the one which was
+// actually changed.
+func getForUpdate(ctx context.Context, tx querier, id int64) (*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE tasks.id = $1
+		FOR UPDATE`
+	var task Task
+	err := tx.QueryRowContext(ctx, query, id).Scan(taskFields(&task)...)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// recordDeletion records the deletion of a task and all of its descendants, which are
+// deleted along with it, on the caller's transaction. The final state of each task is
+// kept in its history. If the task doesn't exist, sql.ErrNoRows is returned.
+func recordDeletion(ctx context.Context, tx querier, id, userID int64) error {
+	task, err := getForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	tasks := []*Task{task}
+	query := `
+		WITH RECURSIVE descendants (id) AS (
+			SELECT id FROM tasks WHERE parent_id = $1 AND deleted_at IS NULL
+			UNION
+			SELECT tasks.id FROM tasks INNER JOIN descendants ON tasks.parent_id = descendants.id
+			WHERE tasks.deleted_at IS NULL
+		)
+		SELECT ` + taskColumns + `
+		FROM tasks
+		INNER JOIN descendants ON descendants.id = tasks.id`
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var descendant Task
+		err := rows.Scan(taskFields(&descendant)...)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, &descendant)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		err = recordHistory(ctx, tx, userID, HistoryDelete, task, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Define the HistoryModel type.
+type HistoryModel struct {
+	DB *sql.DB
+}
+
+// GetAllForTask returns a page of the history of a task. If field isn't empty, only the
+// entries which changed that field are returned.
+func (m HistoryModel) GetAllForTask(taskID int64, field string, filters Filters) ([]*HistoryEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), task_history.id, task_history.created_at, task_history.task_id, task_history.user_id,
+			users.name, task_history.action, task_history.version, task_history.changes
+		FROM task_history
+		LEFT JOIN users ON users.id = task_history.user_id
+		WHERE task_history.task_id = $1 AND (task_history.changes ? $2 OR $2 = '')
+		ORDER BY %s, task_history.id ASC
+		LIMIT $3 OFFSET $4`, filters.orderBy("task_history"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, taskID, field, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	entries := []*HistoryEntry{}
+	for rows.Next() {
+		var (
+			entry   HistoryEntry
+			changes []byte
+		)
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.TaskID,
+			&entry.UserID,
+			&entry.UserName,
+			&entry.Action,
+			&entry.Version,
+			&changes,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		err = json.Unmarshal(changes, &entry.Changes)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
@@ -13,18 +13,42 @@ var (
 )
 
 type Models struct {
-	Tasks       TaskModel
-	Permissions PermissionModel // Add a new Permissions field.
-	Tokens      TokenModel      // Add a new Tokens field.
-	Users       UserModel       // Add a new Users field.
+	Tasks          TaskModel
+	Attachments    AttachmentModel
+	Collaborators  CollaboratorModel
+	Comments       CommentModel
+	Dependencies   DependencyModel
+	History        HistoryModel
+	Permissions    PermissionModel // Add a new Permissions field.
+	ProjectMembers ProjectMemberModel
+	Projects       ProjectModel
+	Reminders      ReminderModel
+	Tags           TagModel
+	TimeEntries    TimeEntryModel
+	Tokens         TokenModel // Add a new Tokens field.
+	Users          UserModel  // Add a new Users field.
+	ViewShares     ViewShareModel
+	Views          ViewModel
 }
 
 // For ease of use, we also add a New() method which returns a Models struct containing the initialized MovieModel.
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Tasks:       TaskModel{DB: db},
-		Permissions: PermissionModel{DB: db}, // Initialize a new PermissionModel instance.
-		Tokens:      TokenModel{DB: db},      // Initialize a new TokenModel instance.
-		Users:       UserModel{DB: db},       // Initialize a new UserModel instance.
+		Tasks:          TaskModel{DB: db},
+		Attachments:    AttachmentModel{DB: db},
+		Collaborators:  CollaboratorModel{DB: db},
+		Comments:       CommentModel{DB: db},
+		Dependencies:   DependencyModel{DB: db},
+		History:        HistoryModel{DB: db},
+		Permissions:    PermissionModel{DB: db}, // Initialize a new PermissionModel instance.
+		ProjectMembers: ProjectMemberModel{DB: db},
+		Projects:       ProjectModel{DB: db},
+		Reminders:      ReminderModel{DB: db},
+		Tags:           TagModel{DB: db},
+		TimeEntries:    TimeEntryModel{DB: db},
+		Tokens:         TokenModel{DB: db}, // Initialize a new TokenModel instance.
+		Users:          UserModel{DB: db},  // Initialize a new UserModel instance.
+		ViewShares:     ViewShareModel{DB: db},
+		Views:          ViewModel{DB: db},
 	}
 }
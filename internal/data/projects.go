@@ -0,0 +1,337 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"time"
+)
+
+// Project groups tasks together. The owner of a project holds the owner role on it, and
+// can add other users as members with a role of their own. Members get the same role on
+// every task in the project.
+type Project struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	UserID      int64           `json:"user_id"` // ID of the user who owns the project
+	Archived    bool            `json:"archived"`
+	Settings    ProjectSettings `json:"settings"`
+	Version     int32           `json:"version"`
+}
+
+// ProjectSettings holds the defaults for new tasks in a project. They're stored as JSON,
+// so that new settings can be added without a migration.
+type ProjectSettings struct {
+	DefaultPriority  string    `json:"default_priority,omitempty"`
+	DefaultReminders Reminders `json:"default_reminders,omitempty"`
+}
+
+// ApplyTo fills in the fields which were left out of a new task with the defaults from
+// the settings.
+func (s ProjectSettings) ApplyTo(task *Task) {
+	if task.Priority == "" {
+		task.Priority = s.DefaultPriority
+	}
+	if task.Reminders == nil {
+		task.Reminders = s.DefaultReminders
+	}
+}
+
+// Implement the database/sql/driver Valuer interface to store the settings as JSON.
+func (s ProjectSettings) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Implement the database/sql Scanner interface to read the settings back from JSON.
+func (s *ProjectSettings) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ProjectSettings", src)
+	}
+	return json.Unmarshal(b, s)
+}
+
+func ValidateProject(v *validator.Validator, project *Project) {
+	v.Check(project.Name != "", "name", "must be provided")
+	v.Check(len(project.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(project.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	v.Check(len(project.Settings.DefaultPriority) <= 50, "settings", "must have a default_priority of not more than 50 bytes")
+	ValidateReminders(v, project.Settings.DefaultReminders)
+}
+
+// projectAccessCondition works like taskAccessCondition(), for the projects on which the
+// user holds at least the required role by owning the project or being a member of it.
+func projectAccessCondition(placeholder, required string) string {
+	return fmt.Sprintf(`(projects.user_id = %[1]s OR EXISTS (
+				SELECT 1 FROM project_members
+				WHERE project_members.project_id = projects.id
+				AND project_members.user_id = %[1]s
+				AND project_members.role IN (%[2]s)))`, placeholder, rolesIncluding(required))
+}
+
+// Define the ProjectModel type, which like TaskModel can optionally run its queries on a
+// transaction (see WithTx()).
+type ProjectModel struct {
+	DB *sql.DB
+	tx *sql.Tx
+}
+
+const projectColumns = `projects.id, projects.created_at, projects.name, projects.description, projects.user_id,
+		projects.archived, projects.settings, projects.version`
+
+func projectFields(project *Project) []interface{} {
+	return []interface{}{
+		&project.ID,
+		&project.CreatedAt,
+		&project.Name,
+		&project.Description,
+		&project.UserID,
+		&project.Archived,
+		&project.Settings,
+		&project.Version,
+	}
+}
+
+func (m ProjectModel) Insert(project *Project) error {
+	query := `
+		INSERT INTO projects (name, description, user_id, archived, settings)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version`
+	args := []interface{}{project.Name, project.Description, project.UserID, project.Archived, project.Settings}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.db().QueryRowContext(ctx, query, args...).Scan(&project.ID, &project.CreatedAt, &project.Version)
+}
+
+// Get returns a specific project, provided that the user with the given ID owns it or is a
+// member of it.
+func (m ProjectModel) Get(id, userID int64) (*Project, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + projectColumns + `
+		FROM projects
+		WHERE projects.id = $1 AND ` + projectAccessCondition("$2", RoleViewer)
+	var project Project
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.db().QueryRowContext(ctx, query, id, userID).Scan(projectFields(&project)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &project, nil
+}
+
+// GetAll returns the projects that the user owns or is a member of, either the archived
+// ones or the active ones.
+func (m ProjectModel) GetAll(userID int64, archived bool, filters Filters) ([]*Project, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM projects
+		WHERE %s AND projects.archived = $2
+		ORDER BY %s, projects.id ASC
+		LIMIT $3 OFFSET $4`, projectColumns, projectAccessCondition("$1", RoleViewer), filters.orderBy("projects"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.db().QueryContext(ctx, query, userID, archived, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	projects := []*Project{}
+	for rows.Next() {
+		var project Project
+		err := rows.Scan(append([]interface{}{&totalRecords}, projectFields(&project)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		projects = append(projects, &project)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return projects, metadata, nil
+}
+
+// Update saves the changes to a project, using the version number to detect edit
+// conflicts in the same way as TaskModel.Update().
+func (m ProjectModel) Update(project *Project) error {
+	query := `
+		UPDATE projects
+		SET name = $1, description = $2, archived = $3, settings = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+	args := []interface{}{project.Name, project.Description, project.Archived, project.Settings, project.ID, project.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&project.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a project. Its tasks are kept, but no longer belong to any project.
+func (m ProjectModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM projects
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.db().ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetRole returns the role that the user holds on a project, and whether they are its
+// owner, in the same way as TaskModel.GetRole().
+func (m ProjectModel) GetRole(id, userID int64) (string, bool, error) {
+	if id < 1 {
+		return "", false, ErrRecordNotFound
+	}
+	query := `
+		SELECT CASE WHEN projects.user_id = $2 THEN 'owner' ELSE project_members.role END, projects.user_id = $2
+		FROM projects
+		LEFT JOIN project_members ON project_members.project_id = projects.id AND project_members.user_id = $2
+		WHERE projects.id = $1 AND (projects.user_id = $2 OR project_members.user_id IS NOT NULL)`
+	var (
+		role  string
+		owner bool
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.db().QueryRowContext(ctx, query, id, userID).Scan(&role, &owner)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", false, ErrRecordNotFound
+		default:
+			return "", false, err
+		}
+	}
+	return role, owner, nil
+}
+
+// ProjectMember represents a user who has been given access to somebody else's project.
+type ProjectMember struct {
+	ProjectID int64     `json:"project_id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateProjectMember(v *validator.Validator, member *ProjectMember) {
+	v.Check(member.Role != "", "role", "must be provided")
+	v.Check(validator.In(member.Role, Roles...), "role", "must be one of viewer, editor or owner")
+}
+
+// Define the ProjectMemberModel type.
+type ProjectMemberModel struct {
+	DB *sql.DB
+}
+
+// Insert adds the user as a member of the project. If the user is already a member their
+// role is replaced with the new one.
+func (m ProjectMemberModel) Insert(member *ProjectMember) error {
+	query := `
+		INSERT INTO project_members (project_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at`
+	args := []interface{}{member.ProjectID, member.UserID, member.Role}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&member.CreatedAt)
+}
+
+// GetAllForProject returns the members of a project, in the order they were added.
+func (m ProjectMemberModel) GetAllForProject(projectID int64) ([]*ProjectMember, error) {
+	query := `
+		SELECT project_members.project_id, users.id, users.name, users.email, project_members.role, project_members.created_at
+		FROM project_members
+		INNER JOIN users ON users.id = project_members.user_id
+		WHERE project_members.project_id = $1
+		ORDER BY project_members.created_at, users.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []*ProjectMember{}
+	for rows.Next() {
+		var member ProjectMember
+		err := rows.Scan(
+			&member.ProjectID,
+			&member.UserID,
+			&member.Name,
+			&member.Email,
+			&member.Role,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// Delete removes a user from the members of a project, returning ErrRecordNotFound if they
+// weren't a member in the first place.
+func (m ProjectMemberModel) Delete(projectID, userID int64) error {
+	query := `
+		DELETE FROM project_members
+		WHERE project_id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, projectID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
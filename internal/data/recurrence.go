@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"time"
+)
+
+// ValidateRecurrence checks that a recurrence rule can be parsed, recording the parser's
+// explanation of the problem if it can't. It also checks that the start of the series,
+// dtstart, is itself an occurrence of the rule. Otherwise the task would be due on a date
+// that the rule never produces, such as a Tuesday for "FREQ=WEEKLY;BYDAY=MO", and every
+// task after it would fall on a different day. A zero dtstart isn't checked, as the
+// missing due date is reported on its own.
+func ValidateRecurrence(v *validator.Validator, recurrence string, dtstart time.Time) {
+	rule, err := ParseRRule(recurrence)
+	if err != nil {
+		v.AddError("recurrence", err.Error())
+		return
+	}
+	if dtstart.IsZero() {
+		return
+	}
+	first, ok := rule.After(dtstart, dtstart.Add(-time.Second))
+	v.Check(ok && first.Equal(dtstart), "recurrence", "must produce an occurrence on the due date that the series starts from")
+}
+
+// SetRecurrence sets the recurrence rule of the task, storing it in canonical form. The
+// current due date of the task becomes the start of the series. An invalid rule is
+// stored as given so that ValidateTask() can report the problem.
+func (t *Task) SetRecurrence(recurrence string) {
+	t.Recurrence = recurrence
+	t.RecurrenceStart = nil
+	if recurrence == "" {
+		return
+	}
+	rule, err := ParseRRule(recurrence)
+	if err != nil {
+		return
+	}
+	start := t.DueDate
+	t.Recurrence = rule.String()
+	t.RecurrenceStart = &start
+}
+
+// recurrenceStart returns the start of the series that the task belongs to, falling back
+// to its due date.
+func (t *Task) recurrenceStart() time.Time {
+	if t.RecurrenceStart != nil {
+		return time.Time(*t.RecurrenceStart)
+	}
+	return time.Time(t.DueDate)
+}
+
+// Occurrences returns the due dates of the task and its future occurrences which fall
+// within the range [from, to], up to a maximum of limit dates. Occurrences before the
+// task's own due date have already happened, so they aren't included.
+func (t *Task) Occurrences(from, to time.Time, limit int) ([]CustomTime, error) {
+	due := time.Time(t.DueDate)
+	if from.Before(due) {
+		from = due
+	}
+	var times []time.Time
+	if t.Recurrence == "" {
+		if !due.Before(from) && !due.After(to) {
+			times = append(times, due)
+		}
+	} else {
+		rule, err := ParseRRule(t.Recurrence)
+		if err != nil {
+			return nil, err
+		}
+		times = rule.Between(t.recurrenceStart(), from, to, limit)
+	}
+	occurrences := make([]CustomTime, len(times))
+	for i := range times {
+		occurrences[i] = CustomTime(times[i])
+	}
+	return occurrences, nil
+}
+
+// NextOccurrence returns a new task for the occurrence of a recurring task which follows
+// this one, with the same details but the next due date in the series. It returns nil if
+// the task doesn't recur or its series has ended. The new task hasn't been inserted yet.
+func (t *Task) NextOccurrence() (*Task, error) {
+	if t.Recurrence == "" {
+		return nil, nil
+	}
+	rule, err := ParseRRule(t.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	due, ok := rule.After(t.recurrenceStart(), time.Time(t.DueDate))
+	if !ok {
+		return nil, nil
+	}
+	start := CustomTime(t.recurrenceStart())
+	return &Task{
+		Title:           t.Title,
+		Description:     t.Description,
+		DueDate:         CustomTime(due),
+		Priority:        t.Priority,
+		Status:          StatusTodo,
+		Category:        t.Category,
+		Tags:            t.Tags,
+		ParentID:        t.ParentID,
+		ProjectID:       t.ProjectID,
+		UserID:          t.UserID,
+		Recurrence:      t.Recurrence,
+		RecurrenceStart: &start,
+		Reminders:       t.Reminders,
+	}, nil
+}
+
+// UpdateWithNext saves a recurring task which has just been completed and inserts the task
+// for its next occurrence in a single transaction, so that the series can neither stop
+// because the insert failed nor carry on from a completion which wasn't saved. Like
+// Update(), it returns ErrEditConflict if the task was changed since it was read.
+func (m TaskModel) UpdateWithNext(task, next *Task, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tasks := m.WithTx(tx.Tx)
+	err = tasks.Update(task, userID)
+	if err != nil {
+		return err
+	}
+	err = tasks.Insert(next)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
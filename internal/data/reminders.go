@@ -0,0 +1,209 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"github.com/lib/pq"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Define an error that the UnmarshalJSON() method on Reminders can return if a reminder
+// offset isn't in a format that we understand.
+var ErrInvalidReminderFormat = errors.New("invalid reminder format")
+
+var reminderRX = regexp.MustCompile(`^(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?$`)
+
+// Reminders holds the offsets before a task's due date at which its owner should be
+// reminded about it. In JSON each offset is written as a string such as "1d", "2h" or
+// "1h30m", and in the database as a number of minutes.
+type Reminders []time.Duration
+
+func (r Reminders) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Strings())
+}
+
+func (r *Reminders) UnmarshalJSON(jsonValue []byte) error {
+	var offsets []string
+	err := json.Unmarshal(jsonValue, &offsets)
+	if err != nil {
+		return ErrInvalidReminderFormat
+	}
+	reminders, err := ParseReminders(offsets)
+	if err != nil {
+		return err
+	}
+	*r = reminders
+	return nil
+}
+
+// Strings returns the offsets in the form that they're written in JSON, such as "1h30m".
+func (r Reminders) Strings() []string {
+	offsets := make([]string, len(r))
+	for i, d := range r {
+		offsets[i] = formatReminder(d)
+	}
+	return offsets
+}
+
+// ParseReminders reads offsets in the form returned by Strings(), returning
+// ErrInvalidReminderFormat if any of them can't be parsed.
+func ParseReminders(offsets []string) (Reminders, error) {
+	reminders := make(Reminders, len(offsets))
+	for i, offset := range offsets {
+		match := reminderRX.FindStringSubmatch(offset)
+		if offset == "" || match == nil {
+			return nil, ErrInvalidReminderFormat
+		}
+		for j, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+			if match[j+1] != "" {
+				n, err := strconv.Atoi(match[j+1])
+				if err != nil {
+					return nil, ErrInvalidReminderFormat
+				}
+				reminders[i] += time.Duration(n) * unit
+			}
+		}
+	}
+	return reminders, nil
+}
+
+func formatReminder(d time.Duration) string {
+	days := d / (24 * time.Hour)
+	hours := d % (24 * time.Hour) / time.Hour
+	minutes := d % time.Hour / time.Minute
+	s := ""
+	if days > 0 {
+		s += fmt.Sprintf("%dd", days)
+	}
+	if hours > 0 {
+		s += fmt.Sprintf("%dh", hours)
+	}
+	if minutes > 0 || s == "" {
+		s += fmt.Sprintf("%dm", minutes)
+	}
+	return s
+}
+
+// Implement the database/sql/driver Valuer interface to store the offsets as minutes.
+func (r Reminders) Value() (driver.Value, error) {
+	minutes := make(pq.Int64Array, len(r))
+	for i, d := range r {
+		minutes[i] = int64(d / time.Minute)
+	}
+	return minutes.Value()
+}
+
+// Implement the database/sql Scanner interface to read the offsets back from minutes.
+func (r *Reminders) Scan(value interface{}) error {
+	var minutes pq.Int64Array
+	err := minutes.Scan(value)
+	if err != nil {
+		return err
+	}
+	reminders := make(Reminders, len(minutes))
+	for i, m := range minutes {
+		reminders[i] = time.Duration(m) * time.Minute
+	}
+	*r = reminders
+	return nil
+}
+
+func ValidateReminders(v *validator.Validator, reminders Reminders) {
+	v.Check(len(reminders) <= 5, "reminders", "must not contain more than 5 reminders")
+	seen := make(map[time.Duration]bool)
+	for _, d := range reminders {
+		v.Check(d > 0, "reminders", "must only contain offsets greater than zero")
+		v.Check(d <= 365*24*time.Hour, "reminders", "must only contain offsets of at most a year")
+		v.Check(!seen[d], "reminders", "must not contain duplicate offsets")
+		seen[d] = true
+	}
+}
+
+// Reminder is a reminder which is due to be sent to the owner of a task.
+type Reminder struct {
+	TaskID    int64
+	Title     string
+	DueDate   time.Time
+	Offset    time.Duration
+	UserName  string
+	UserEmail string
+}
+
+// Define the ReminderModel type.
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// GetDue returns the reminders which should be sent now: those for open tasks whose due
+// date is still ahead, but no further ahead than the reminder offset, and which haven't
+// already been sent for the task's current due date. Tasks without any reminder offsets
+// of their own use defaultOffset.
+func (m ReminderModel) GetDue(defaultOffset time.Duration) ([]*Reminder, error) {
+	query := `
+		SELECT tasks.id, tasks.title, tasks.due_date, offsets.minutes, users.name, users.email
+		FROM tasks
+		INNER JOIN users ON users.id = tasks.user_id
+		CROSS JOIN LATERAL unnest(CASE
+			WHEN cardinality(tasks.reminder_offsets) > 0 THEN tasks.reminder_offsets
+			ELSE ARRAY[$1::integer]
+		END) AS offsets (minutes)
+		WHERE tasks.status <> $2 AND tasks.deleted_at IS NULL
+		AND tasks.due_date > NOW()
+		AND tasks.due_date - offsets.minutes * INTERVAL '1 minute' <= NOW()
+		AND NOT EXISTS (
+			SELECT 1 FROM task_reminders
+			WHERE task_reminders.task_id = tasks.id
+			AND task_reminders.offset_minutes = offsets.minutes
+			AND task_reminders.due_date = tasks.due_date
+		)
+		ORDER BY tasks.due_date, tasks.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, int64(defaultOffset/time.Minute), StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reminders []*Reminder
+	for rows.Next() {
+		var reminder Reminder
+		var minutes int64
+		err := rows.Scan(
+			&reminder.TaskID,
+			&reminder.Title,
+			&reminder.DueDate,
+			&minutes,
+			&reminder.UserName,
+			&reminder.UserEmail,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminder.Offset = time.Duration(minutes) * time.Minute
+		reminders = append(reminders, &reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// MarkSent records that a reminder has been sent, so that GetDue() doesn't return it again.
+func (m ReminderModel) MarkSent(reminder *Reminder) error {
+	query := `
+		INSERT INTO task_reminders (task_id, offset_minutes, due_date)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+	args := []interface{}{reminder.TaskID, int64(reminder.Offset / time.Minute), reminder.DueDate}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
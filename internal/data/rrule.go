@@ -0,0 +1,438 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Define the recurrence frequencies that we support from RFC 5545. The sub-daily
+// frequencies (SECONDLY, MINUTELY and HOURLY) make little sense for tasks, so they're
+// rejected by ParseRRule().
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// maxRRuleYears caps how far ahead of the start of a series a rule is expanded, so that a
+// rule which rarely or never produces an occurrence can't keep the expansion loop running
+// for long. The Gregorian calendar repeats every 400 years, so a rule which hasn't
+// produced an occurrence by then never will.
+const maxRRuleYears = 400
+
+var (
+	weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+	byDayRX      = regexp.MustCompile(`^([+-]?\d{1,2})?(SU|MO|TU|WE|TH|FR|SA)$`)
+)
+
+// WeekdayNum is a single entry in a BYDAY rule part, such as MO, 2TU or -1FR. N is zero
+// when the entry matches every such weekday in the period.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+func (wn WeekdayNum) String() string {
+	if wn.N == 0 {
+		return weekdayCodes[wn.Day]
+	}
+	return strconv.Itoa(wn.N) + weekdayCodes[wn.Day]
+}
+
+// RRule holds a parsed RFC 5545 recurrence rule. Only the FREQ, INTERVAL, BYDAY,
+// BYMONTHDAY, COUNT and UNTIL rule parts are supported.
+type RRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+}
+
+// ParseRRule parses a recurrence rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH". The
+// value may optionally start with "RRULE:", as it does inside an iCalendar file.
+func ParseRRule(value string) (*RRule, error) {
+	value = strings.TrimSpace(value)
+	if len(value) >= 6 && strings.EqualFold(value[:6], "RRULE:") {
+		value = value[6:]
+	}
+	if value == "" {
+		return nil, errors.New("must not be empty")
+	}
+	rule := &RRule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ";") {
+		name, val, found := strings.Cut(part, "=")
+		if !found || val == "" {
+			return nil, fmt.Errorf("rule part %q must be in the form NAME=VALUE", part)
+		}
+		name = strings.ToUpper(name)
+		val = strings.ToUpper(val)
+		if seen[name] {
+			return nil, fmt.Errorf("rule part %s must not be repeated", name)
+		}
+		seen[name] = true
+		switch name {
+		case "FREQ":
+			switch val {
+			case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+				rule.Freq = val
+			default:
+				return nil, errors.New("FREQ must be one of DAILY, WEEKLY, MONTHLY or YEARLY")
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 1000 {
+				return nil, errors.New("INTERVAL must be an integer between 1 and 1000")
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 10_000 {
+				return nil, errors.New("COUNT must be an integer between 1 and 10000")
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseRRuleTime(val)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, item := range strings.Split(val, ",") {
+				match := byDayRX.FindStringSubmatch(item)
+				if match == nil {
+					return nil, fmt.Errorf("BYDAY value %q is not a valid weekday", item)
+				}
+				var wn WeekdayNum
+				if match[1] != "" {
+					wn.N, _ = strconv.Atoi(match[1])
+					if wn.N == 0 || wn.N < -53 || wn.N > 53 {
+						return nil, fmt.Errorf("BYDAY value %q has an invalid ordinal", item)
+					}
+				}
+				for i, code := range weekdayCodes {
+					if code == match[2] {
+						wn.Day = time.Weekday(i)
+					}
+				}
+				rule.ByDay = append(rule.ByDay, wn)
+			}
+		case "BYMONTHDAY":
+			for _, item := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(item)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("BYMONTHDAY value %q must be between 1 and 31 or -31 and -1", item)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		default:
+			return nil, fmt.Errorf("rule part %s is not supported", name)
+		}
+	}
+	if rule.Freq == "" {
+		return nil, errors.New("FREQ must be provided")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, errors.New("COUNT and UNTIL must not both be provided")
+	}
+	if rule.Freq == FreqWeekly && len(rule.ByMonthDay) > 0 {
+		return nil, errors.New("BYMONTHDAY must not be used with FREQ=WEEKLY")
+	}
+	for _, wn := range rule.ByDay {
+		switch {
+		case wn.N != 0 && rule.Freq != FreqMonthly && rule.Freq != FreqYearly:
+			return nil, errors.New("BYDAY ordinals can only be used with FREQ=MONTHLY or FREQ=YEARLY")
+		case wn.N != 0 && rule.Freq == FreqMonthly && (wn.N < -5 || wn.N > 5):
+			return nil, errors.New("BYDAY ordinals must be between -5 and 5 with FREQ=MONTHLY")
+		}
+	}
+	// BYDAY and BYMONTHDAY can be combined in ways which never match a date, such as the
+	// first Monday of a month falling on the 31st.
+	if len(rule.ByDay) > 0 && len(rule.ByMonthDay) > 0 && !rule.matchesAnyDate() {
+		return nil, errors.New("BYDAY and BYMONTHDAY must match at least one date together")
+	}
+	return rule, nil
+}
+
+// matchesAnyDate reports whether the rule matches any date at all, ignoring INTERVAL,
+// COUNT and UNTIL.
+func (r *RRule) matchesAnyDate() bool {
+	every := *r
+	every.Interval, every.Count, every.Until = 1, 0, time.Time{}
+	start := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	_, found := every.After(start, start.Add(-time.Second))
+	return found
+}
+
+// parseRRuleTime parses an UNTIL value, which is either a date or a date-time. Date-times
+// without a trailing "Z" are floating, and we treat them as UTC.
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			// A bare date includes the whole of that day.
+			if layout == "20060102" {
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL value %q must be a date (YYYYMMDD) or UTC date-time (YYYYMMDDTHHMMSSZ)", value)
+}
+
+// String returns the rule in its canonical form, with the rule parts in a fixed order.
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wn := range r.ByDay {
+			days[i] = wn.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, n := range r.ByMonthDay {
+			days[i] = strconv.Itoa(n)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of the rule for a series starting at dtstart which
+// fall within the range [from, to], up to a maximum of limit occurrences.
+func (r *RRule) Between(dtstart, from, to time.Time, limit int) []time.Time {
+	occurrences := []time.Time{}
+	r.iterate(dtstart, func(t time.Time) bool {
+		if t.After(to) || len(occurrences) >= limit {
+			return false
+		}
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+		return true
+	})
+	return occurrences
+}
+
+// After returns the first occurrence of the rule for a series starting at dtstart which
+// is strictly after t. The boolean result is false if the series has ended by then.
+func (r *RRule) After(dtstart, t time.Time) (time.Time, bool) {
+	var next time.Time
+	var found bool
+	r.iterate(dtstart, func(occurrence time.Time) bool {
+		if occurrence.After(t) {
+			next, found = occurrence, true
+			return false
+		}
+		return true
+	})
+	return next, found
+}
+
+// iterate calls fn with each occurrence of the rule in order, starting from dtstart and
+// honouring COUNT and UNTIL, until fn returns false, the series ends or the periods
+// within maxRRuleYears of dtstart have all been expanded.
+func (r *RRule) iterate(dtstart time.Time, fn func(time.Time) bool) {
+	count := 0
+	periods := r.maxPeriods()
+	for period := 0; period < periods; period++ {
+		for _, candidate := range r.candidates(dtstart, period*r.Interval) {
+			if candidate.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && candidate.After(r.Until) {
+				return
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return
+			}
+			if !fn(candidate) {
+				return
+			}
+		}
+	}
+}
+
+// maxPeriods returns the number of periods (days, weeks, months or years) that the rule
+// is expanded over, which is enough to cover maxRRuleYears years.
+func (r *RRule) maxPeriods() int {
+	periods := maxRRuleYears
+	switch r.Freq {
+	case FreqDaily:
+		periods *= 366
+	case FreqWeekly:
+		periods *= 53
+	case FreqMonthly:
+		periods *= 12
+	}
+	return periods/r.Interval + 1
+}
+
+// candidates returns the sorted occurrence times that the rule produces in the period
+// which is offset periods (days, weeks, months or years) after the one containing
+// dtstart. The times are not yet checked against dtstart, COUNT or UNTIL.
+func (r *RRule) candidates(dtstart time.Time, offset int) []time.Time {
+	y, m, d := dtstart.Date()
+	h, mi, s := dtstart.Clock()
+	loc := dtstart.Location()
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, h, mi, s, 0, loc)
+	}
+
+	var days []time.Time
+	switch r.Freq {
+	case FreqDaily:
+		day := date(y, m, d+offset)
+		if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+			days = append(days, day)
+		}
+	case FreqWeekly:
+		// Weeks start on a Monday, which is the RFC 5545 default for WKST.
+		monday := date(y, m, d-(int(dtstart.Weekday())+6)%7+7*offset)
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if len(r.ByDay) == 0 && day.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case FreqMonthly:
+		first := date(y, m+time.Month(offset), 1)
+		days = r.daysInMonth(first, d)
+	case FreqYearly:
+		year := y + offset
+		switch {
+		case len(r.ByDay) == 0 && len(r.ByMonthDay) == 0:
+			day := date(year, m, d)
+			// Skip years where the date doesn't exist, such as 29 February.
+			if day.Month() == m {
+				days = append(days, day)
+			}
+		case len(r.ByMonthDay) > 0:
+			for month := time.January; month <= time.December; month++ {
+				for _, day := range r.daysInMonth(date(year, month, 1), d) {
+					if r.matchesYearWeekday(day) {
+						days = append(days, day)
+					}
+				}
+			}
+		default:
+			for day := date(year, time.January, 1); day.Year() == year; day = day.AddDate(0, 0, 1) {
+				if r.matchesYearWeekday(day) {
+					days = append(days, day)
+				}
+			}
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// daysInMonth returns the days matched by the rule in the month starting at first. With
+// neither BYMONTHDAY nor BYDAY set, the day of the month of dtstart is used.
+func (r *RRule) daysInMonth(first time.Time, startDay int) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	var days []time.Time
+	for n := 1; n <= last; n++ {
+		day := first.AddDate(0, 0, n-1)
+		switch {
+		case len(r.ByMonthDay) > 0:
+			if !r.matchesMonthDay(day) {
+				continue
+			}
+			if len(r.ByDay) > 0 && !r.matchesMonthWeekday(day) {
+				continue
+			}
+		case len(r.ByDay) > 0:
+			if !r.matchesMonthWeekday(day) {
+				continue
+			}
+		default:
+			if n != startDay {
+				continue
+			}
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// matchesWeekday reports whether the day matches BYDAY, ignoring any ordinals. It is
+// used for the daily and weekly frequencies, where ordinals aren't allowed.
+func (r *RRule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wn := range r.ByDay {
+		if wn.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay reports whether the day matches BYMONTHDAY, where negative values
+// count backwards from the last day of the month.
+func (r *RRule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	for _, n := range r.ByMonthDay {
+		if n == day.Day() || last+n+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthWeekday reports whether the day matches BYDAY, with ordinals counting the
+// occurrences of the weekday within the month (so 2TU is the second Tuesday).
+func (r *RRule) matchesMonthWeekday(day time.Time) bool {
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	return r.matchesOrdinalWeekday(day, (day.Day()-1)/7+1, -((last-day.Day())/7 + 1))
+}
+
+// matchesYearWeekday reports whether the day matches BYDAY, with ordinals counting the
+// occurrences of the weekday within the year (so 20MO is the twentieth Monday).
+func (r *RRule) matchesYearWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	last := time.Date(day.Year(), time.December, 31, 0, 0, 0, 0, day.Location()).YearDay()
+	return r.matchesOrdinalWeekday(day, (day.YearDay()-1)/7+1, -((last-day.YearDay())/7 + 1))
+}
+
+func (r *RRule) matchesOrdinalWeekday(day time.Time, fromStart, fromEnd int) bool {
+	for _, wn := range r.ByDay {
+		if wn.Day != day.Weekday() {
+			continue
+		}
+		if wn.N == 0 || wn.N == fromStart || wn.N == fromEnd {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+package data
+
+import (
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"strings"
+	"testing"
+	"time"
+)
+
+// at returns 09:00 UTC on the given date, which is written as YYYYMMDD like the dates in
+// the examples of RFC 5545.
+func at(date string) time.Time {
+	t, err := time.Parse("20060102", date)
+	if err != nil {
+		panic(err)
+	}
+	return t.Add(9 * time.Hour)
+}
+
+func dates(values ...string) []time.Time {
+	times := make([]time.Time, len(values))
+	for i, value := range values {
+		times[i] = at(value)
+	}
+	return times
+}
+
+// TestRRuleOccurrences checks the occurrences of rules against the examples in section
+// 3.8.5.3 of RFC 5545, leaving out the rule parts that we don't support. Series which
+// never end are cut off at limit occurrences; the others are given enough room to show
+// that they stop where they should.
+func TestRRuleOccurrences(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart string
+		limit   int
+		want    []time.Time
+	}{
+		{
+			name:    "daily for 10 occurrences",
+			rule:    "FREQ=DAILY;COUNT=10",
+			dtstart: "19970902",
+			limit:   100,
+			want:    dates("19970902", "19970903", "19970904", "19970905", "19970906", "19970907", "19970908", "19970909", "19970910", "19970911"),
+		},
+		{
+			name:    "daily until a date",
+			rule:    "FREQ=DAILY;UNTIL=19970905",
+			dtstart: "19970902",
+			limit:   100,
+			want:    dates("19970902", "19970903", "19970904", "19970905"),
+		},
+		{
+			name:    "daily until a date-time",
+			rule:    "FREQ=DAILY;UNTIL=19970905T000000Z",
+			dtstart: "19970902",
+			limit:   100,
+			want:    dates("19970902", "19970903", "19970904"),
+		},
+		{
+			name:    "every other day",
+			rule:    "FREQ=DAILY;INTERVAL=2",
+			dtstart: "19970902",
+			limit:   4,
+			want:    dates("19970902", "19970904", "19970906", "19970908"),
+		},
+		{
+			name:    "weekly on Tuesday and Thursday",
+			rule:    "FREQ=WEEKLY;COUNT=10;BYDAY=TU,TH",
+			dtstart: "19970902",
+			limit:   100,
+			want:    dates("19970902", "19970904", "19970909", "19970911", "19970916", "19970918", "19970923", "19970925", "19970930", "19971002"),
+		},
+		{
+			name:    "every other week on Monday, Wednesday and Friday",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;UNTIL=19971024T000000Z;BYDAY=MO,WE,FR",
+			dtstart: "19970901",
+			limit:   100,
+			want:    dates("19970901", "19970903", "19970905", "19970915", "19970917", "19970919", "19970929", "19971001", "19971003", "19971013", "19971015", "19971017"),
+		},
+		{
+			name:    "every other week with weeks starting on Monday",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU",
+			dtstart: "19970805",
+			limit:   100,
+			want:    dates("19970805", "19970810", "19970819", "19970824"),
+		},
+		{
+			name:    "monthly on the first Friday",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYDAY=1FR",
+			dtstart: "19970905",
+			limit:   100,
+			want:    dates("19970905", "19971003", "19971107", "19971205", "19980102", "19980206", "19980306", "19980403", "19980501", "19980605"),
+		},
+		{
+			name:    "monthly on the second-to-last Monday",
+			rule:    "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO",
+			dtstart: "19970922",
+			limit:   100,
+			want:    dates("19970922", "19971020", "19971117", "19971222", "19980119", "19980216"),
+		},
+		{
+			name:    "monthly on the third-to-last day",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-3",
+			dtstart: "19970928",
+			limit:   6,
+			want:    dates("19970928", "19971029", "19971128", "19971229", "19980129", "19980226"),
+		},
+		{
+			name:    "monthly on the 2nd and 15th",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYMONTHDAY=2,15",
+			dtstart: "19970902",
+			limit:   100,
+			want:    dates("19970902", "19970915", "19971002", "19971015", "19971102", "19971115", "19971202", "19971215", "19980102", "19980115"),
+		},
+		{
+			name:    "monthly on the first and last day",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYMONTHDAY=1,-1",
+			dtstart: "19970930",
+			limit:   100,
+			want:    dates("19970930", "19971001", "19971031", "19971101", "19971130", "19971201", "19971231", "19980101", "19980131", "19980201"),
+		},
+		{
+			name:    "every Friday the 13th",
+			rule:    "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13",
+			dtstart: "19970902",
+			limit:   5,
+			want:    dates("19980213", "19980313", "19981113", "19990813", "20001013"),
+		},
+		{
+			name:    "monthly on the 31st skips shorter months",
+			rule:    "FREQ=MONTHLY;COUNT=4",
+			dtstart: "20230131",
+			limit:   100,
+			want:    dates("20230131", "20230331", "20230531", "20230731"),
+		},
+		{
+			name:    "the 20th Monday of the year",
+			rule:    "FREQ=YEARLY;COUNT=3;BYDAY=20MO",
+			dtstart: "19970519",
+			limit:   100,
+			want:    dates("19970519", "19980518", "19990517"),
+		},
+		{
+			name:    "the last Sunday of the year",
+			rule:    "FREQ=YEARLY;COUNT=2;BYDAY=-1SU",
+			dtstart: "19971228",
+			limit:   100,
+			want:    dates("19971228", "19981227"),
+		},
+		{
+			name:    "29 February only in leap years",
+			rule:    "FREQ=YEARLY;COUNT=3",
+			dtstart: "20000229",
+			limit:   100,
+			want:    dates("20000229", "20040229", "20080229"),
+		},
+		{
+			name:    "29 February every hundred years",
+			rule:    "FREQ=YEARLY;INTERVAL=100",
+			dtstart: "20000229",
+			limit:   100,
+			want:    dates("20000229", "24000229"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRRule(%q) returned error: %v", tt.rule, err)
+			}
+			dtstart := at(tt.dtstart)
+			got := rule.Between(dtstart, dtstart, dtstart.AddDate(maxRRuleYears, 0, 0), tt.limit)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences %v, want %d %v", len(got), got, len(tt.want), tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRRuleAfter(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      string
+		dtstart   string
+		after     string
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "next occurrence",
+			rule:      "FREQ=WEEKLY;BYDAY=MO,TH",
+			dtstart:   "20231009",
+			after:     "20231009",
+			want:      "20231012",
+			wantFound: true,
+		},
+		{
+			name:      "after the last occurrence",
+			rule:      "FREQ=DAILY;COUNT=3",
+			dtstart:   "20231009",
+			after:     "20231011",
+			wantFound: false,
+		},
+		{
+			name:      "after the end of the series",
+			rule:      "FREQ=DAILY;UNTIL=20231011",
+			dtstart:   "20231009",
+			after:     "20231011",
+			wantFound: false,
+		},
+		{
+			name:      "beyond the 400 year cap",
+			rule:      "FREQ=YEARLY;INTERVAL=500",
+			dtstart:   "20231009",
+			after:     "20231009",
+			wantFound: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRRule(%q) returned error: %v", tt.rule, err)
+			}
+			start := time.Now()
+			got, found := rule.After(at(tt.dtstart), at(tt.after))
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("After() took %v", elapsed)
+			}
+			if found != tt.wantFound {
+				t.Fatalf("After() found = %v, want %v", found, tt.wantFound)
+			}
+			if found && !got.Equal(at(tt.want)) {
+				t.Errorf("After() = %v, want %v", got, at(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", want: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+		{value: "RRULE:freq=monthly;byday=-1fr", want: "FREQ=MONTHLY;BYDAY=-1FR"},
+		{value: "COUNT=5;FREQ=DAILY;INTERVAL=1", want: "FREQ=DAILY;COUNT=5"},
+		{value: "FREQ=DAILY;UNTIL=20231231", want: "FREQ=DAILY;UNTIL=20231231T235959Z"},
+		{value: "", wantErr: "must not be empty"},
+		{value: "FREQ=HOURLY", wantErr: "FREQ must be one of"},
+		{value: "INTERVAL=2", wantErr: "FREQ must be provided"},
+		{value: "FREQ=DAILY;FREQ=WEEKLY", wantErr: "must not be repeated"},
+		{value: "FREQ=DAILY;INTERVAL=0", wantErr: "INTERVAL must be"},
+		{value: "FREQ=DAILY;COUNT=2;UNTIL=20231231", wantErr: "COUNT and UNTIL"},
+		{value: "FREQ=DAILY;BYMONTH=1", wantErr: "not supported"},
+		{value: "FREQ=WEEKLY;BYDAY=1MO", wantErr: "BYDAY ordinals can only be used"},
+		{value: "FREQ=MONTHLY;BYDAY=6MO", wantErr: "between -5 and 5"},
+		{value: "FREQ=YEARLY;BYDAY=54MO", wantErr: "invalid ordinal"},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=0", wantErr: "BYMONTHDAY value"},
+		{value: "FREQ=WEEKLY;BYMONTHDAY=1", wantErr: "must not be used with FREQ=WEEKLY"},
+		{value: "FREQ=MONTHLY;BYDAY=1MO;BYMONTHDAY=31", wantErr: "must match at least one date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			rule, err := ParseRRule(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseRRule(%q) error = %v, want one containing %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRRule(%q) returned error: %v", tt.value, err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateRecurrence checks that a rule is only accepted when the due date that the
+// series starts from is one of its occurrences.
+func TestValidateRecurrence(t *testing.T) {
+	tests := []struct {
+		rule    string
+		dtstart string
+		valid   bool
+	}{
+		{rule: "FREQ=WEEKLY;BYDAY=MO", dtstart: "20231009", valid: true},
+		{rule: "FREQ=WEEKLY;BYDAY=MO", dtstart: "20231010", valid: false},
+		{rule: "FREQ=DAILY;INTERVAL=7;BYDAY=MO", dtstart: "20231010", valid: false},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=-1", dtstart: "20231031", valid: true},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=-1", dtstart: "20231030", valid: false},
+		{rule: "FREQ=YEARLY", dtstart: "20240229", valid: true},
+		{rule: "FREQ=DAILY;UNTIL=20231001", dtstart: "20231010", valid: false},
+		{rule: "FREQ=FORTNIGHTLY", dtstart: "20231010", valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+"@"+tt.dtstart, func(t *testing.T) {
+			v := validator.New()
+			ValidateRecurrence(v, tt.rule, at(tt.dtstart))
+			if v.Valid() != tt.valid {
+				t.Errorf("valid = %v, want %v (errors: %v)", v.Valid(), tt.valid, v.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package data
+
+import (
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Limits on the search queries accepted by ParseSearch(), so that a single request can't
+// produce an arbitrarily large SQL query.
+const (
+	maxSearchLength = 1000
+	maxSearchTerms  = 50
+)
+
+// searchFields lists the fields which can be used in a search query.
+var searchFields = []string{"status", "priority", "category", "tag", "project", "owner", "due", "created", "is"}
+
+// SearchSyntaxError describes a problem with a search query. Position is the 1-based
+// position of the character in the query where the problem was found.
+type SearchSyntaxError struct {
+	Position int
+	Message  string
+}
+
+func (e *SearchSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Position, e.Message)
+}
+
+// Search is a parsed search query, as accepted by ParseSearch(). The zero value matches
+// every task.
+type Search struct {
+	terms []searchTerm
+}
+
+// searchTerm is a single condition of a search query. All of the terms of a query must
+// match, unless they're negated, in which case they must not.
+type searchTerm struct {
+	negate bool
+	// text is the word or phrase to search for, for a term which isn't a condition on a
+	// field.
+	text string
+	// condition returns the SQL for a term on a field, recording the values that it needs
+	// as placeholder parameters in where.
+	condition func(where *sqlConditions) string
+}
+
+// ParseSearch parses a search query such as
+//
+//	status:open priority:high due<2025-01-01 -category:personal "release notes"
+//
+// The query is a list of terms separated by whitespace, all of which must match. A term
+// is either a word or "quoted phrase" which must appear in the title or description of
+// the task, or a condition on a field in the form field:value. The fields are:
+//
+//   - status, priority, category, tag: the task has the value, or any of a comma-separated
+//     list of values. The status can also be "open" (not yet completed) or "done".
+//   - project, owner: the task is in the project, or owned by the user, with the given ID.
+//   - due, created: the due date or creation time is on the given date (YYYY-MM-DD). These
+//     fields can also be compared with <, <=, > and >=, as in due<2025-01-01, and take a
+//     date-time in RFC 3339 form as well as a date.
+//   - is:overdue: the task is past its due date and not yet completed.
+//
+// Values containing spaces can be quoted, as in category:"side project", and any term can
+// be negated by starting it with a minus sign. A word which only looks like a condition,
+// such as https://example.com, is searched for as text, as its prefix isn't a field.
+func ParseSearch(query string) (*Search, error) {
+	if len(query) > maxSearchLength {
+		return nil, &SearchSyntaxError{Position: 1, Message: fmt.Sprintf("query must not be more than %d bytes long", maxSearchLength)}
+	}
+	p := &searchParser{input: []rune(query)}
+	search := &Search{}
+	for {
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		if len(search.terms) == maxSearchTerms {
+			return nil, p.errorf(p.pos, "query must not contain more than %d terms", maxSearchTerms)
+		}
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		search.terms = append(search.terms, term)
+	}
+	return search, nil
+}
+
+// add adds the conditions for the terms of the search to where. Words and phrases are
+// matched against the search_vector column using the language of each task.
+func (s *Search) add(where *sqlConditions) {
+	if s == nil {
+		return
+	}
+	for _, term := range s.terms {
+		var condition string
+		if term.condition == nil {
+			condition = fmt.Sprintf("tasks.search_vector @@ phraseto_tsquery(%s, %s)", taskSearchConfig, where.arg(term.text))
+		} else {
+			condition = term.condition(where)
+		}
+		if term.negate {
+			// A negated condition must also match rows where the condition is NULL,
+			// such as tasks without a project for -project:1.
+			condition = fmt.Sprintf("(%s) IS NOT TRUE", condition)
+		}
+		where.add(condition)
+	}
+}
+
+// texts returns the words and phrases that tasks must contain to match the search.
+func (s *Search) texts() []string {
+	if s == nil {
+		return nil
+	}
+	var texts []string
+	for _, term := range s.terms {
+		if term.condition == nil && !term.negate {
+			texts = append(texts, term.text)
+		}
+	}
+	return texts
+}
+
+// HasText reports whether the search includes any words or phrases that tasks must
+// contain, in which case the results can be ranked by relevance.
+func (s *Search) HasText() bool {
+	return len(s.texts()) > 0
+}
+
+// searchParser holds the state of ParseSearch() as it works through the query.
+type searchParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *searchParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *searchParser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *searchParser) skipSpace() {
+	for !p.done() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// errorf returns a SearchSyntaxError for the problem at the given (0-based) position.
+func (p *searchParser) errorf(pos int, format string, args ...interface{}) error {
+	return &SearchSyntaxError{Position: pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+// term parses a single term, starting at a character which isn't whitespace.
+func (p *searchParser) term() (searchTerm, error) {
+	var term searchTerm
+	if p.peek() == '-' {
+		p.pos++
+		if p.done() || unicode.IsSpace(p.peek()) {
+			return term, p.errorf(p.pos-1, "expected a term after -")
+		}
+		term.negate = true
+	}
+	start := p.pos
+
+	// A quoted phrase is always searched for as text.
+	if p.peek() == '"' {
+		phrase, err := p.quoted()
+		if err != nil {
+			return term, err
+		}
+		if strings.TrimSpace(phrase) == "" {
+			return term, p.errorf(start, "quoted phrase must not be empty")
+		}
+		term.text = phrase
+		return term, nil
+	}
+
+	// Otherwise the term is a condition on a field if it starts with the name of one of
+	// the fields followed by an operator, and a word to search for as text if it doesn't,
+	// so that words such as https://example.com and re:meeting can be searched for.
+	for !p.done() && (unicode.IsLetter(p.peek()) || p.peek() == '_') {
+		p.pos++
+	}
+	field := strings.ToLower(string(p.input[start:p.pos]))
+	op := p.operator()
+	if !validator.In(field, searchFields...) || op == "" {
+		p.pos = start
+		term.text = p.word()
+		return term, nil
+	}
+
+	valueStart := p.pos
+	var value string
+	if p.peek() == '"' {
+		var err error
+		value, err = p.quoted()
+		if err != nil {
+			return term, err
+		}
+	} else {
+		value = p.word()
+	}
+	if value == "" {
+		return term, p.errorf(valueStart, "expected a value after %s%s", field, op)
+	}
+
+	var err error
+	term.condition, err = p.fieldCondition(field, op, value, start, valueStart)
+	return term, err
+}
+
+// operator consumes and returns the operator following a field name, or returns "" if
+// there isn't one.
+func (p *searchParser) operator() string {
+	switch p.peek() {
+	case ':':
+		p.pos++
+		return ":"
+	case '<', '>':
+		op := string(p.peek())
+		p.pos++
+		if p.peek() == '=' {
+			p.pos++
+			op += "="
+		}
+		return op
+	}
+	return ""
+}
+
+// word consumes and returns the characters up to the next whitespace.
+func (p *searchParser) word() string {
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+// quoted consumes a quoted string, starting at the opening quote, and returns its
+// contents. A quote can be included in the string by escaping it with a backslash.
+func (p *searchParser) quoted() (string, error) {
+	start := p.pos
+	p.pos++
+	var sb strings.Builder
+	for !p.done() {
+		r := p.peek()
+		p.pos++
+		switch {
+		case r == '"':
+			return sb.String(), nil
+		case r == '\\' && !p.done():
+			sb.WriteRune(p.peek())
+			p.pos++
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return "", p.errorf(start, "unterminated quoted string")
+}
+
+// fieldCondition returns the condition for a field term. The start and valueStart
+// positions are used to point any error at the field or the value.
+func (p *searchParser) fieldCondition(field, op, value string, start, valueStart int) (func(*sqlConditions) string, error) {
+	if op != ":" && field != "due" && field != "created" {
+		return nil, p.errorf(start+len([]rune(field)), "field %s only supports the : operator", field)
+	}
+	switch field {
+	case "status":
+		values := strings.Split(value, ",")
+		var statuses []string
+		for _, status := range values {
+			switch status {
+			case "open":
+				statuses = append(statuses, StatusTodo, StatusInProgress)
+			case "done":
+				statuses = append(statuses, StatusCompleted)
+			case StatusTodo, StatusInProgress, StatusCompleted:
+				statuses = append(statuses, status)
+			default:
+				return nil, p.errorf(valueStart, "status must be one of open, done, to-do, in-progress or completed")
+			}
+		}
+		return anyCondition("tasks.status", statuses), nil
+	case "priority", "category":
+		values, err := p.list(value, valueStart)
+		if err != nil {
+			return nil, err
+		}
+		return anyCondition("tasks."+field, values), nil
+	case "tag":
+		values, err := p.list(value, valueStart)
+		if err != nil {
+			return nil, err
+		}
+		tags := NormalizeTags(values)
+		return func(where *sqlConditions) string {
+			return fmt.Sprintf(`EXISTS (
+				SELECT 1 FROM task_tags
+				INNER JOIN tags ON tags.id = task_tags.tag_id
+				WHERE task_tags.task_id = tasks.id AND tags.name = ANY(%s))`, where.arg(pq.Array(tags)))
+		}, nil
+	case "project", "owner":
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 1 {
+			return nil, p.errorf(valueStart, "%s must be a positive integer", field)
+		}
+		column := "tasks.project_id"
+		if field == "owner" {
+			column = "tasks.user_id"
+		}
+		return func(where *sqlConditions) string {
+			return column + " = " + where.arg(id)
+		}, nil
+	case "due", "created":
+		column := "tasks.due_date"
+		if field == "created" {
+			column = "tasks.created_at"
+		}
+		return p.timeCondition(column, op, value, valueStart)
+	case "is":
+		if value != "overdue" {
+			return nil, p.errorf(valueStart, "is must be overdue")
+		}
+		return func(where *sqlConditions) string {
+			return fmt.Sprintf("tasks.due_date < NOW() AND tasks.status <> %s", where.arg(StatusCompleted))
+		}, nil
+	}
+	panic("unhandled search field: " + field)
+}
+
+// list splits a comma-separated value, which must not contain any empty items.
+func (p *searchParser) list(value string, valueStart int) ([]string, error) {
+	values := strings.Split(value, ",")
+	for _, v := range values {
+		if v == "" {
+			return nil, p.errorf(valueStart, "list must not contain empty values")
+		}
+	}
+	return values, nil
+}
+
+// timeCondition returns the condition comparing the column with a date or date-time. A
+// date stands for the whole day, so due:2025-01-01 matches any time on that day and
+// due<=2025-01-01 anything up to the end of it.
+func (p *searchParser) timeCondition(column, op, value string, valueStart int) (func(*sqlConditions) string, error) {
+	var (
+		t      time.Time
+		err    error
+		isDate bool
+	)
+	t, err = time.Parse("2006-01-02", value)
+	if err == nil {
+		isDate = true
+	} else {
+		t, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, p.errorf(valueStart, "must be a date (YYYY-MM-DD) or an RFC 3339 date-time")
+		}
+	}
+	end := t
+	if isDate {
+		end = t.AddDate(0, 0, 1)
+	}
+	return func(where *sqlConditions) string {
+		switch op {
+		case "<":
+			return column + " < " + where.arg(t)
+		case "<=":
+			if isDate {
+				return column + " < " + where.arg(end)
+			}
+			return column + " <= " + where.arg(t)
+		case ">":
+			if isDate {
+				return column + " >= " + where.arg(end)
+			}
+			return column + " > " + where.arg(t)
+		case ">=":
+			return column + " >= " + where.arg(t)
+		default:
+			if isDate {
+				from, to := where.arg(t), where.arg(end)
+				return fmt.Sprintf("%s >= %s AND %s < %s", column, from, column, to)
+			}
+			return column + " = " + where.arg(t)
+		}
+	}, nil
+}
+
+// anyCondition returns a condition matching rows where the column has any of the values.
+func anyCondition(column string, values []string) func(*sqlConditions) string {
+	return func(where *sqlConditions) string {
+		return fmt.Sprintf("%s = ANY(%s)", column, where.arg(pq.Array(values)))
+	}
+}
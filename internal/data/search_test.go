@@ -0,0 +1,206 @@
+package data
+
+import (
+	"errors"
+	"github.com/lib/pq"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		where string
+		args  []interface{}
+	}{
+		{
+			name:  "empty",
+			query: "  ",
+			where: "TRUE",
+		},
+		{
+			name:  "words",
+			query: "release notes",
+			where: "(tasks.search_vector @@ phraseto_tsquery(tasks.language, $1))\n\t\tAND (tasks.search_vector @@ phraseto_tsquery(tasks.language, $2))",
+			args:  []interface{}{"release", "notes"},
+		},
+		{
+			name:  "quoted phrase",
+			query: `"release notes"`,
+			where: "(tasks.search_vector @@ phraseto_tsquery(tasks.language, $1))",
+			args:  []interface{}{"release notes"},
+		},
+		{
+			name:  "escaped quotes",
+			query: `"say \"hi\" \\ there"`,
+			where: "(tasks.search_vector @@ phraseto_tsquery(tasks.language, $1))",
+			args:  []interface{}{`say "hi" \ there`},
+		},
+		{
+			name:  "negated word",
+			query: "-draft",
+			where: "((tasks.search_vector @@ phraseto_tsquery(tasks.language, $1)) IS NOT TRUE)",
+			args:  []interface{}{"draft"},
+		},
+		{
+			name:  "status",
+			query: "status:open",
+			where: "(tasks.status = ANY($1))",
+			args:  []interface{}{pq.Array([]string{StatusTodo, StatusInProgress})},
+		},
+		{
+			name:  "negated field",
+			query: "-category:personal",
+			where: "((tasks.category = ANY($1)) IS NOT TRUE)",
+			args:  []interface{}{pq.Array([]string{"personal"})},
+		},
+		{
+			name:  "quoted value",
+			query: `Category:"side project,work"`,
+			where: "(tasks.category = ANY($1))",
+			args:  []interface{}{pq.Array([]string{"side project", "work"})},
+		},
+		{
+			name:  "list",
+			query: "priority:high,low",
+			where: "(tasks.priority = ANY($1))",
+			args:  []interface{}{pq.Array([]string{"high", "low"})},
+		},
+		{
+			name:  "owner",
+			query: "owner:42",
+			where: "(tasks.user_id = $1)",
+			args:  []interface{}{int64(42)},
+		},
+		{
+			name:  "on a date",
+			query: "due:2025-01-01",
+			where: "(tasks.due_date >= $1 AND tasks.due_date < $2)",
+			args:  []interface{}{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "up to the end of a date",
+			query: "due<=2025-01-01",
+			where: "(tasks.due_date < $1)",
+			args:  []interface{}{time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "after a date",
+			query: "due>2025-01-01",
+			where: "(tasks.due_date >= $1)",
+			args:  []interface{}{time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "before a date-time",
+			query: "created<2025-01-01T10:00:00Z",
+			where: "(tasks.created_at < $1)",
+			args:  []interface{}{time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "up to a date-time",
+			query: "created<=2025-01-01T10:00:00Z",
+			where: "(tasks.created_at <= $1)",
+			args:  []interface{}{time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "overdue",
+			query: "is:overdue",
+			where: "(tasks.due_date < NOW() AND tasks.status <> $1)",
+			args:  []interface{}{StatusCompleted},
+		},
+		{
+			name:  "unknown prefix",
+			query: "re:meeting https://example.com",
+			where: "(tasks.search_vector @@ phraseto_tsquery(tasks.language, $1))\n\t\tAND (tasks.search_vector @@ phraseto_tsquery(tasks.language, $2))",
+			args:  []interface{}{"re:meeting", "https://example.com"},
+		},
+		{
+			name:  "field without an operator",
+			query: "status",
+			where: "(tasks.search_vector @@ phraseto_tsquery(tasks.language, $1))",
+			args:  []interface{}{"status"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search, err := ParseSearch(tt.query)
+			if err != nil {
+				t.Fatalf("ParseSearch(%q) returned error: %v", tt.query, err)
+			}
+			var where sqlConditions
+			search.add(&where)
+			if got := where.String(); got != tt.where {
+				t.Errorf("conditions = %q, want %q", got, tt.where)
+			}
+			if !reflect.DeepEqual(where.args, tt.args) {
+				t.Errorf("args = %#v, want %#v", where.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseSearchTexts(t *testing.T) {
+	search, err := ParseSearch(`budget -draft status:open "next week"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"budget", "next week"}
+	if got := search.texts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("texts() = %q, want %q", got, want)
+	}
+	if !search.HasText() {
+		t.Error("HasText() = false, want true")
+	}
+	search, err = ParseSearch("-draft status:open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if search.HasText() {
+		t.Error("HasText() = true, want false")
+	}
+}
+
+// TestParseSearchErrors checks that bad queries are rejected with a SearchSyntaxError
+// pointing at the right character.
+func TestParseSearchErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+		message  string
+	}{
+		{query: `"unterminated`, position: 1, message: "unterminated quoted string"},
+		{query: `a status:"open`, position: 10, message: "unterminated quoted string"},
+		{query: `""`, position: 1, message: "quoted phrase must not be empty"},
+		{query: "a - b", position: 3, message: "expected a term after -"},
+		{query: "a -", position: 3, message: "expected a term after -"},
+		{query: "status:", position: 8, message: "expected a value after status:"},
+		{query: "status:nope", position: 8, message: "status must be one of"},
+		{query: "priority<high", position: 9, message: "only supports the : operator"},
+		{query: "tag:a,,b", position: 5, message: "list must not contain empty values"},
+		{query: "x project:0", position: 11, message: "project must be a positive integer"},
+		{query: "due:tomorrow", position: 5, message: "must be a date"},
+		{query: "due>=2025-13-01", position: 6, message: "must be a date"},
+		{query: "is:late", position: 4, message: "is must be overdue"},
+		{query: "é status:nope", position: 10, message: "status must be one of"},
+		{query: strings.Repeat("a", maxSearchLength+1), position: 1, message: "must not be more than"},
+		{query: strings.Repeat("a ", maxSearchTerms) + "b", position: 2*maxSearchTerms + 1, message: "must not contain more than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseSearch(tt.query)
+			var syntaxErr *SearchSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("ParseSearch(%q) error = %v, want a SearchSyntaxError", tt.query, err)
+			}
+			if syntaxErr.Position != tt.position {
+				t.Errorf("Position = %d, want %d", syntaxErr.Position, tt.position)
+			}
+			if !strings.Contains(syntaxErr.Message, tt.message) {
+				t.Errorf("Message = %q, want one containing %q", syntaxErr.Message, tt.message)
+			}
+		})
+	}
+}
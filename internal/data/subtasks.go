@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+// Define a custom ErrParentCycle error, returned by Update() when the new parent of a task
+// is the task itself or one of its descendants.
+var (
+	ErrParentCycle = errors.New("parent cycle")
+)
+
+// maxTaskDepth caps how deep the walks over the subtree of a task go which need to know
+// the depth of each task. Update() doesn't let the hierarchy loop, but if it ever did,
+// the walks would otherwise never finish. The other walks use UNION, which stops by
+// itself when it comes back round to a task it has already seen.
+const maxTaskDepth = 1000
+
+// TaskTree is a task together with all of its descendants. Because the Task is embedded,
+// its fields are encoded at the top level of each node in the JSON output.
+type TaskTree struct {
+	*Task
+	Subtasks []*TaskTree `json:"subtasks"`
+}
+
+// attachProgress sets the Progress field on each of the given tasks which has at least
+// one descendant, using a single recursive query to walk all of their subtrees at once.
+func (m TaskModel) attachProgress(ctx context.Context, tasks ...*Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+	}
+	query := `
+		WITH RECURSIVE descendants (root_id, id, status) AS (
+			SELECT parent_id, id, status FROM tasks WHERE parent_id = ANY($1) AND deleted_at IS NULL
+			UNION
+			SELECT descendants.root_id, tasks.id, tasks.status
+			FROM tasks
+			INNER JOIN descendants ON tasks.parent_id = descendants.id
+			WHERE tasks.deleted_at IS NULL
+		)
+		SELECT root_id, count(*), count(*) FILTER (WHERE status = $2)
+		FROM descendants
+		GROUP BY root_id`
+	rows, err := m.db().QueryContext(ctx, query, pq.Array(ids), StatusCompleted)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	progress := make(map[int64]int)
+	for rows.Next() {
+		var rootID int64
+		var total, completed int
+		err := rows.Scan(&rootID, &total, &completed)
+		if err != nil {
+			return err
+		}
+		progress[rootID] = completed * 100 / total
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if p, ok := progress[task.ID]; ok {
+			task.Progress = &p
+		}
+	}
+	return nil
+}
+
+// GetSubtasks returns the direct children of a task. Access to the subtasks follows from
+// access to the parent, so the caller is expected to have checked that already.
+func (m TaskModel) GetSubtasks(parentID int64) ([]*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE tasks.parent_id = $1 AND tasks.deleted_at IS NULL
+		ORDER BY tasks.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.db().QueryContext(ctx, query, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tasks := []*Task{}
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(taskFields(&task)...)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	err = m.attachProgress(ctx, tasks...)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// GetTree returns a task along with its whole subtree of descendants, provided that the
+// user with the given ID can see the task at the root of the tree.
+func (m TaskModel) GetTree(id, userID int64) (*TaskTree, error) {
+	root, err := m.Get(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	// The descendants are ordered by depth, so every parent is read before its children.
+	query := `
+		WITH RECURSIVE descendants (id, depth) AS (
+			SELECT id, 1 FROM tasks WHERE parent_id = $1 AND deleted_at IS NULL
+			UNION ALL
+			SELECT tasks.id, descendants.depth + 1
+			FROM tasks
+			INNER JOIN descendants ON tasks.parent_id = descendants.id
+			WHERE tasks.deleted_at IS NULL AND descendants.depth < ` + strconv.Itoa(maxTaskDepth) + `
+		)
+		SELECT ` + taskColumns + `
+		FROM tasks
+		INNER JOIN descendants ON descendants.id = tasks.id
+		ORDER BY descendants.depth, tasks.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.db().QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tree := &TaskTree{Task: root, Subtasks: []*TaskTree{}}
+	nodes := map[int64]*TaskTree{root.ID: tree}
+	var tasks []*Task
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(taskFields(&task)...)
+		if err != nil {
+			return nil, err
+		}
+		node := &TaskTree{Task: &task, Subtasks: []*TaskTree{}}
+		nodes[task.ID] = node
+		parent := nodes[*task.ParentID]
+		parent.Subtasks = append(parent.Subtasks, node)
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	err = m.attachProgress(ctx, tasks...)
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// CountSubtasks returns the number of direct children of a task.
+func (m TaskModel) CountSubtasks(id int64) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM tasks
+		WHERE parent_id = $1 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var count int
+	err := m.db().QueryRowContext(ctx, query, id).Scan(&count)
+	return count, err
+}
+
+// InSubtree reports whether the task with ID candidateID is the task with ID rootID or one
+// of its descendants. It is used to stop a task being moved underneath itself.
+func (m TaskModel) InSubtree(rootID, candidateID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return inSubtree(ctx, m.db(), rootID, candidateID)
+}
+
+func inSubtree(ctx context.Context, q querier, rootID, candidateID int64) (bool, error) {
+	query := `
+		WITH RECURSIVE subtree (id) AS (
+			SELECT $1::bigint
+			UNION
+			SELECT tasks.id
+			FROM tasks
+			INNER JOIN subtree ON tasks.parent_id = subtree.id
+			WHERE tasks.deleted_at IS NULL
+		)
+		SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)`
+	var found bool
+	err := q.QueryRowContext(ctx, query, rootID, candidateID).Scan(&found)
+	return found, err
+}
+
+// checkNewParent makes sure, on the caller's transaction, that a task can be moved under
+// the parent with ID parentID without making the hierarchy loop. Reparenting is
+// serialised with a transaction-level advisory lock: otherwise two requests moving A
+// under B and B under A could each check the hierarchy before the other had changed it,
+// and both go ahead. The lock is held until the transaction ends.
+func checkNewParent(ctx context.Context, tx querier, id, parentID int64) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('tasks.parent_id'))`)
+	if err != nil {
+		return err
+	}
+	loop, err := inSubtree(ctx, tx, id, parentID)
+	if err != nil {
+		return err
+	}
+	if loop {
+		return ErrParentCycle
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"github.com/lib/pq"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Define constants for the ways in which a list of tags can be matched against the tags on
+// a task: a task matches if it has any of the tags, or only if it has all of them.
+const (
+	TagsMatchAny = "any"
+	TagsMatchAll = "all"
+)
+
+// Tag holds the name of a tag and the number of tasks which carry it.
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags trims the whitespace around each tag and lowercases it, so that "Backend"
+// and " backend" are treated as the same tag. The tags are sorted in the same order that
+// they are read back from the database in.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, len(tags))
+	for i := range tags {
+		normalized[i] = strings.ToLower(strings.TrimSpace(tags[i]))
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+func ValidateTags(v *validator.Validator, tags []string) {
+	v.Check(len(tags) <= 20, "tags", "must not contain more than 20 tags")
+	for _, tag := range tags {
+		v.Check(tag != "", "tags", "must not contain empty tags")
+		v.Check(len(tag) <= 50, "tags", "must not contain tags more than 50 bytes long")
+		v.Check(!strings.Contains(tag, ","), "tags", "must not contain commas")
+	}
+	v.Check(validator.Unique(tags), "tags", "must not contain duplicate values")
+}
+
+// setTaskTags replaces the tags on a task with the given ones, creating any tags which
+// don't exist yet. It runs on the caller's transaction, so that the tags are saved
+// together with the rest of the task.
+func setTaskTags(ctx context.Context, tx querier, taskID int64, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	queries := []string{
+		`INSERT INTO tags (name)
+		SELECT unnest($2::text[])
+		ON CONFLICT (name) DO NOTHING`,
+		`DELETE FROM task_tags
+		WHERE task_id = $1 AND tag_id NOT IN (SELECT id FROM tags WHERE name = ANY($2))`,
+		`INSERT INTO task_tags (task_id, tag_id)
+		SELECT $1, id FROM tags WHERE name = ANY($2)
+		ON CONFLICT DO NOTHING`,
+	}
+	for _, query := range queries {
+		_, err := tx.ExecContext(ctx, query, taskID, pq.Array(tags))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Define the TagModel type.
+type TagModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser returns the tags on the tasks that the user can see, with the number of
+// those tasks carrying each tag, most used first.
+func (m TagModel) GetAllForUser(userID int64) ([]*Tag, error) {
+	query := `
+		SELECT tags.name, count(*)
+		FROM tags
+		INNER JOIN task_tags ON task_tags.tag_id = tags.id
+		INNER JOIN tasks ON tasks.id = task_tags.task_id
+		WHERE tasks.deleted_at IS NULL AND ` + taskAccessCondition("$1", RoleViewer) + `
+		GROUP BY tags.name
+		ORDER BY count(*) DESC, tags.name`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []*Tag{}
+	for rows.Next() {
+		var tag Tag
+		err := rows.Scan(&tag.Name, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
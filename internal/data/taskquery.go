@@ -0,0 +1,216 @@
+package data
+
+import (
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskQuery holds the conditions that GetAll() filters tasks on. The zero value matches
+// every task, apart from those in archived projects. Where a field holds a list of
+// values, a task matches if it has any of them.
+type TaskQuery struct {
+	Title string
+	// If any tags are given, only tasks carrying any of them match, or only those
+	// carrying all of them when TagsMatch is TagsMatchAll.
+	Tags      []string
+	TagsMatch string
+	// Only tasks in the project match if ProjectID isn't zero.
+	ProjectID int64
+	// Tasks in archived projects are left out unless IncludeArchived is set.
+	IncludeArchived bool
+	Statuses        []string
+	Priorities      []string
+	Categories      []string
+	// IDs of the users who own the tasks.
+	Owners []int64
+	// Bounds on the due date and creation time. The "after" bounds are inclusive and the
+	// "before" bounds exclusive, and a zero time leaves that side of the range open.
+	DueAfter      time.Time
+	DueBefore     time.Time
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Only tasks which are past their due date and not yet completed match if Overdue is set.
+	Overdue bool
+	// A search in the query language parsed by ParseSearch(), or nil.
+	Search *Search
+}
+
+// SearchLanguages lists the languages that users can choose from for full-text search.
+// Each is the name of a text search configuration which is built into PostgreSQL, and
+// determines how words are stemmed and which stop words are ignored.
+var SearchLanguages = []string{"simple", "danish", "dutch", "english", "finnish", "french", "german", "hungarian",
+	"italian", "norwegian", "portuguese", "romanian", "russian", "spanish", "swedish", "turkish"}
+
+// taskSearchConfig is the text search configuration that words and phrases are matched
+// against a task with. The search_vector column of each task is built with the language
+// of the task, so the words being looked for have to be stemmed in the same way, whatever
+// the language of the user searching for them.
+const taskSearchConfig = "tasks.language"
+
+// tsquery returns an expression for the tsquery which matches everything that the query
+// searches for in the text of tasks, or "" if it doesn't search for any text.
+func (q TaskQuery) tsquery(where *sqlConditions) string {
+	var parts []string
+	if q.Title != "" {
+		parts = append(parts, fmt.Sprintf("plainto_tsquery(%s, %s)", taskSearchConfig, where.arg(q.Title)))
+	}
+	for _, text := range q.Search.texts() {
+		parts = append(parts, fmt.Sprintf("phraseto_tsquery(%s, %s)", taskSearchConfig, where.arg(text)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(parts, " && ") + ")"
+}
+
+// ValidateTaskQuery checks the values in a TaskQuery. The errors use the names of the
+// query string parameters that the fields are read from.
+func ValidateTaskQuery(v *validator.Validator, q TaskQuery) {
+	v.Check(validator.In(q.TagsMatch, TagsMatchAny, TagsMatchAll), "tags_mode", "must be any or all")
+	v.Check(q.ProjectID >= 0, "project", "must be a positive integer")
+	for _, status := range q.Statuses {
+		v.Check(validator.In(status, Statuses...), "status", "must only contain to-do, in-progress or completed")
+	}
+	for _, priority := range q.Priorities {
+		v.Check(priority != "", "priority", "must not contain empty values")
+	}
+	for _, category := range q.Categories {
+		v.Check(category != "", "category", "must not contain empty values")
+	}
+	for _, owner := range q.Owners {
+		v.Check(owner > 0, "owner", "must only contain positive integers")
+	}
+	v.Check(q.DueAfter.IsZero() || q.DueBefore.IsZero() || q.DueAfter.Before(q.DueBefore), "due_before", "must be later than due_after")
+	v.Check(q.CreatedAfter.IsZero() || q.CreatedBefore.IsZero() || q.CreatedAfter.Before(q.CreatedBefore), "created_before", "must be later than created_after")
+}
+
+// conditions returns the WHERE clause matching the tasks that the user with the given ID
+// can see and which match the query. Only the conditions for the fields which are set
+// are included, and every value is passed as a placeholder parameter, never as part of
+// the SQL itself.
+func (q TaskQuery) conditions(userID int64) *sqlConditions {
+	where := &sqlConditions{}
+	where.add("tasks.deleted_at IS NULL")
+	where.add(taskAccessCondition(where.arg(userID), RoleViewer))
+	if q.Title != "" {
+		// Despite its name, the title filter searches the description as well.
+		where.add(fmt.Sprintf("tasks.search_vector @@ plainto_tsquery(%s, %s)", taskSearchConfig, where.arg(q.Title)))
+	}
+	if len(q.Tags) > 0 {
+		// Count how many of the tags the task carries: any one is enough in the "any"
+		// mode, but in the "all" mode it has to carry every one of them.
+		required := 1
+		if q.TagsMatch == TagsMatchAll {
+			required = len(q.Tags)
+		}
+		where.add(fmt.Sprintf(`(
+			SELECT count(*) FROM task_tags
+			INNER JOIN tags ON tags.id = task_tags.tag_id
+			WHERE task_tags.task_id = tasks.id AND tags.name = ANY(%s)
+		) >= %s`, where.arg(pq.Array(q.Tags)), where.arg(required)))
+	}
+	if q.ProjectID != 0 {
+		where.add("tasks.project_id = " + where.arg(q.ProjectID))
+	}
+	if !q.IncludeArchived {
+		where.add("NOT EXISTS (SELECT 1 FROM projects WHERE projects.id = tasks.project_id AND projects.archived)")
+	}
+	if len(q.Statuses) > 0 {
+		where.add(fmt.Sprintf("tasks.status = ANY(%s)", where.arg(pq.Array(q.Statuses))))
+	}
+	if len(q.Priorities) > 0 {
+		where.add(fmt.Sprintf("tasks.priority = ANY(%s)", where.arg(pq.Array(q.Priorities))))
+	}
+	if len(q.Categories) > 0 {
+		where.add(fmt.Sprintf("tasks.category = ANY(%s)", where.arg(pq.Array(q.Categories))))
+	}
+	if len(q.Owners) > 0 {
+		where.add(fmt.Sprintf("tasks.user_id = ANY(%s)", where.arg(pq.Array(q.Owners))))
+	}
+	if !q.DueAfter.IsZero() {
+		where.add("tasks.due_date >= " + where.arg(q.DueAfter))
+	}
+	if !q.DueBefore.IsZero() {
+		where.add("tasks.due_date < " + where.arg(q.DueBefore))
+	}
+	if !q.CreatedAfter.IsZero() {
+		where.add("tasks.created_at >= " + where.arg(q.CreatedAfter))
+	}
+	if !q.CreatedBefore.IsZero() {
+		where.add("tasks.created_at < " + where.arg(q.CreatedBefore))
+	}
+	if q.Overdue {
+		where.add(fmt.Sprintf("tasks.due_date < NOW() AND tasks.status <> '%s'", StatusCompleted))
+	}
+	q.Search.add(where)
+	return where
+}
+
+// priorityOrder lists the task priorities allowed by the tasks_priority_check constraint,
+// from lowest to highest. Sorting by priority follows this order.
+var priorityOrder = []string{"low", "medium", "high"}
+
+// taskSortKeys returns the keys that tasks are sorted by for the sort in filters. The
+// priority and status are sorted by their meaning rather than alphabetically, and the
+// rank expression is what tasks are sorted by for "relevance", which comes out best match
+// first unless the sort is reversed.
+func taskSortKeys(filters Filters, rank string) []sortKey {
+	keys := filters.sortKeys()
+	for i := range keys {
+		switch keys[i].expr {
+		case "relevance":
+			keys[i] = sortKey{expr: rank, desc: !keys[i].desc}
+		case "priority":
+			keys[i].expr = positionIn("tasks.priority", priorityOrder)
+		case "status":
+			keys[i].expr = positionIn("tasks.status", Statuses)
+		default:
+			keys[i].expr = "tasks." + keys[i].expr
+		}
+	}
+	return keys
+}
+
+// positionIn returns an expression for the position of the value of expr in values,
+// counting from 1, or 0 if it isn't one of them. The values are included in the SQL as
+// they are, so they must be constants.
+func positionIn(expr string, values []string) string {
+	var sb strings.Builder
+	sb.WriteString("CASE " + expr)
+	for i, value := range values {
+		fmt.Fprintf(&sb, " WHEN '%s' THEN %d", value, i+1)
+	}
+	sb.WriteString(" ELSE 0 END")
+	return sb.String()
+}
+
+// sqlConditions collects the conditions of a WHERE clause together with the values for
+// their placeholder parameters.
+type sqlConditions struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg records a value for a placeholder parameter, and returns the placeholder to use for
+// it in the SQL, such as "$3".
+func (c *sqlConditions) arg(value interface{}) string {
+	c.args = append(c.args, value)
+	return "$" + strconv.Itoa(len(c.args))
+}
+
+// add adds a condition which every row must meet.
+func (c *sqlConditions) add(condition string) {
+	c.conditions = append(c.conditions, "("+condition+")")
+}
+
+// String returns the conditions joined with AND, ready to follow the WHERE keyword.
+func (c *sqlConditions) String() string {
+	if len(c.conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(c.conditions, "\n\t\tAND ")
+}
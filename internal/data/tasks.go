@@ -6,59 +6,198 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Bayashat/TaskNinja/internal/validator"
+	"github.com/lib/pq"
+	"strings"
 	"time"
 )
 
+// Define constants for the statuses of the task workflow.
+const (
+	StatusTodo       = "to-do"
+	StatusInProgress = "in-progress"
+	StatusCompleted  = "completed"
+)
+
+// Define a custom ErrDuplicateICalUID error, returned by Insert() when the owner already
+// has a task imported from the same iCalendar to-do.
+var (
+	ErrDuplicateICalUID = errors.New("duplicate iCalendar UID")
+)
+
 type Task struct {
 	ID          int64      `json:"id"`          // Unique integer ID for the task
 	CreatedAt   CustomTime `json:"created_at"`  // Timestamp for when the task is added to our database
+	UpdatedAt   CustomTime `json:"updated_at"`  // Timestamp for when the task was last changed
 	Title       string     `json:"title"`       // Task title
 	Description string     `json:"description"` //  Task description
 	DueDate     CustomTime `json:"due_date"`    // Deadline or due date for the task
 	Priority    string     `json:"priority"`    // Task priority (e.g., high, medium, low)
-	Status      string     `json:"status"`      // Task status (e.g., to-do, in-progress, completed)
+	Status      string     `json:"status"`      // Task status (to-do, in-progress or completed)
 	Category    string     `json:"category"`    // Task category or project it belongs to
-	UserID      int64      `json:"user_id"`     // ID of the user who created the task (for multi-user support)
+	Tags        []string   `json:"tags"`        // Tags on the task, in alphabetical order
+	ParentID    *int64     `json:"parent_id"`   // ID of the parent task, or nil for a top-level task
+	ProjectID   *int64     `json:"project_id"`  // ID of the project the task belongs to, if any
+	UserID      int64      `json:"user_id"`     // ID of the user who owns the task
 	Version     int32      `json:"version"`
+	// RFC 5545 recurrence rule for repeating tasks, and the due date of the first task in
+	// the series, which the rule is expanded from.
+	Recurrence      string      `json:"recurrence,omitempty"`
+	RecurrenceStart *CustomTime `json:"recurrence_start,omitempty"`
+	// How long before the due date the owner should be reminded about the task.
+	Reminders Reminders `json:"reminders"`
+	// When the task was first moved to in-progress, and when it was completed.
+	StartedAt   *CustomTime `json:"started_at,omitempty"`
+	CompletedAt *CustomTime `json:"completed_at,omitempty"`
+	// When the task was moved to the trash, or nil if it hasn't been.
+	DeletedAt *CustomTime `json:"deleted_at,omitempty"`
+	// Percentage of the task's descendants which are completed. It is computed when the
+	// task is read, and only set for tasks which actually have subtasks.
+	Progress *int `json:"progress,omitempty"`
+	// The total number of seconds tracked against the task in time entries which have
+	// been stopped. It is computed when the task is read.
+	TimeSpent int64 `json:"time_spent_seconds"`
+	// The UID of the iCalendar to-do that the task was imported from, if it was.
+	ICalUID string `json:"ical_uid,omitempty"`
+	// A snippet of the title and description with the words that were searched for
+	// highlighted. It is only set on the results of a full-text search.
+	Headline string `json:"headline,omitempty"`
+	// The description rendered from Markdown to sanitized HTML. It is only set when the
+	// client asks for it with render=html.
+	DescriptionHTML string `json:"description_html,omitempty"`
 }
 
-func ValidateTask(v *validator.Validator, task *Task) {
+// ValidateTask checks the fields of a task. Descriptions are Markdown, and may be up to
+// maxDescriptionLength bytes long.
+func ValidateTask(v *validator.Validator, task *Task, maxDescriptionLength int) {
 	v.Check(task.Title != "", "title", "must be provided")
 	v.Check(len(task.Title) <= 500, "title", "must not be more than 500 bytes long")
 	v.Check(task.Description != "", "description", "must be provided")
-	v.Check(len(task.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	v.Check(len(task.Description) <= maxDescriptionLength, "description", fmt.Sprintf("must not be more than %d bytes long", maxDescriptionLength))
 	v.Check(!task.DueDate.IsZero(), "due_date", "must be provided")
 	v.Check(task.DueDate.Before(time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)), "due_date", "must be before 2060")
 	v.Check(task.DueDate.After(time.Date(2023, 10, 7, 0, 0, 0, 0, time.UTC)), "due_date", "must be after 2023-10-07")
 	v.Check(task.Priority != "", "priority", "must be provided")
 	v.Check(task.Status != "", "status", "must be provided")
+	v.Check(validator.In(task.Status, Statuses...), "status", "must be one of to-do, in-progress or completed")
 	v.Check(task.Category != "", "category", "must be provided")
+	v.Check(len(task.ICalUID) <= 500, "uid", "must not be more than 500 bytes long")
+	ValidateTags(v, task.Tags)
+	v.Check(task.ParentID == nil || *task.ParentID > 0, "parent_id", "must be a positive integer")
+	v.Check(task.ParentID == nil || *task.ParentID != task.ID, "parent_id", "must not refer to the task itself")
+	v.Check(task.ProjectID == nil || *task.ProjectID > 0, "project_id", "must be a positive integer")
+	if task.Recurrence != "" {
+		ValidateRecurrence(v, task.Recurrence, task.recurrenceStart())
+	}
+	ValidateReminders(v, task.Reminders)
 }
 
-// Define a TaskModel struct type which wraps a sql.DB connection pool.
+// Define a TaskModel struct type which wraps a sql.DB connection pool, and optionally a
+// transaction that its queries run on (see WithTx()).
 type TaskModel struct {
 	DB *sql.DB
+	tx *sql.Tx
+}
+
+// taskColumns lists the columns that are read into a Task, in the same order as the
+// destinations returned by taskFields(). Queries which read whole tasks select these
+// columns so that adding a field to Task only needs changing in one place.
+const taskColumns = `tasks.id, tasks.created_at, tasks.updated_at, tasks.title, tasks.description, tasks.due_date, tasks.priority,
+		tasks.status, tasks.category, tasks.parent_id, tasks.user_id, tasks.version, tasks.recurrence, tasks.recurrence_start,
+		tasks.reminder_offsets, tasks.started_at, tasks.completed_at, tasks.project_id, tasks.deleted_at,
+		COALESCE(tasks.ical_uid, ''),
+		(SELECT COALESCE(SUM(EXTRACT(EPOCH FROM time_entries.stopped_at - time_entries.started_at)), 0)::bigint
+			FROM time_entries WHERE time_entries.task_id = tasks.id AND time_entries.stopped_at IS NOT NULL),
+		ARRAY(SELECT tags.name FROM task_tags INNER JOIN tags ON tags.id = task_tags.tag_id
+			WHERE task_tags.task_id = tasks.id ORDER BY tags.name)`
+
+// taskFields returns the scan destinations for the columns in taskColumns.
+func taskFields(task *Task) []interface{} {
+	return []interface{}{
+		&task.ID,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&task.Title,
+		&task.Description,
+		&task.DueDate,
+		&task.Priority,
+		&task.Status,
+		&task.Category,
+		&task.ParentID,
+		&task.UserID,
+		&task.Version,
+		&task.Recurrence,
+		&task.RecurrenceStart,
+		&task.Reminders,
+		&task.StartedAt,
+		&task.CompletedAt,
+		&task.ProjectID,
+		&task.DeletedAt,
+		&task.ICalUID,
+		&task.TimeSpent,
+		pq.Array(&task.Tags),
+	}
 }
 
 // Add a placeholder method for inserting a new record in the task table.
 func (m TaskModel) Insert(task *Task) error {
 	// Define the SQL query for inserting a new record in the task table and returning the system-generated data.
+	// The owner of the task is taken from task.UserID, which the caller must set, and the
+	// task is indexed for full-text search in the owner's language.
 	query := `
-		INSERT INTO tasks (title, description, priority, status, category, due_date)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, user_id, version`
+		INSERT INTO tasks (title, description, priority, status, category, due_date, user_id, parent_id,
+			recurrence, recurrence_start, reminder_offsets, started_at, completed_at, project_id, ical_uid, language)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''),
+			COALESCE((SELECT language FROM users WHERE id = $7), 'simple')::regconfig)
+		RETURNING id, created_at, updated_at, version`
 	// Create an args slice containing the values for the placeholder parameters from the task struct.
 	// Declaring this slice immediately next to our SQL query helps to make it nice
 	// 		and clear *what values are being used where* in the query.
-	args := []interface{}{task.Title, task.Description, task.Priority, task.Status, task.Category, task.DueDate}
-	// Use the QueryRow() method to execute the SQL query on our connection pool,
+	args := []interface{}{task.Title, task.Description, task.Priority, task.Status, task.Category, task.DueDate, task.UserID, task.ParentID,
+		task.Recurrence, task.RecurrenceStart, task.Reminders, task.StartedAt, task.CompletedAt, task.ProjectID, task.ICalUID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// The tags and the history live in their own tables, so insert the task, its tags and
+	// the first entry in its history in a transaction.
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Use the QueryRowContext() method to execute the SQL query on the transaction,
 	// passing in the args slice as a variadic parameter
-	// and scanning the system-generated id, created_at and version values into the movie struct.
-	return m.DB.QueryRow(query, args...).Scan(&task.ID, &task.CreatedAt, &task.UserID, &task.Version)
+	// and scanning the system-generated id, created_at and version values into the task struct.
+	// If the user already has a task imported from the same iCalendar to-do, the insert
+	// violates the unique index on ical_uid, and we return ErrDuplicateICalUID instead.
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt, &task.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tasks_ical_uid_idx"`:
+			return ErrDuplicateICalUID
+		default:
+			return err
+		}
+	}
+	err = setTaskTags(ctx, tx, task.ID, task.Tags)
+	if err != nil {
+		return err
+	}
+	// Read the task back as it was saved, and record its creation by the owner.
+	created, err := getForUpdate(ctx, tx, task.ID)
+	if err != nil {
+		return err
+	}
+	err = recordHistory(ctx, tx, task.UserID, HistoryCreate, nil, created)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Add a placeholder method for fetching a specific record from the task table.
-func (m TaskModel) Get(id int64) (*Task, error) {
+// Fetch a specific record from the task table. Only tasks that the user with the given ID
+// owns or collaborates on are returned; anyone else's task is reported as ErrRecordNotFound.
+func (m TaskModel) Get(id, userID int64) (*Task, error) {
 	// The PostgreSQL bigserial type that we're using for the movie ID starts auto-incrementing at 1 by default,
 	// so we know that no task will have ID values less than that.
 	// To avoid making an unnecessary database call, we take a shortcut and return an ErrRecordNotFound error straight away.
@@ -67,9 +206,9 @@ func (m TaskModel) Get(id int64) (*Task, error) {
 	}
 	// Define the SQL query for retrieving the task data.
 	query := `
-		SELECT id, created_at, title, description, priority, status, category, due_date, user_id, version
+		SELECT ` + taskColumns + `
 		FROM tasks
-		WHERE id = $1`
+		WHERE tasks.id = $1 AND tasks.deleted_at IS NULL AND ` + taskAccessCondition("$2", RoleViewer)
 	// Declare a Task struct to hold the data returned by the query.
 	var task Task
 
@@ -81,18 +220,7 @@ func (m TaskModel) Get(id int64) (*Task, error) {
 	defer cancel()
 
 	// Use the QueryRowContext() method to execute the query, passing in the context with the deadline as the first argument.
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&task.ID,
-		&task.CreatedAt,
-		&task.Title,
-		&task.Description,
-		&task.Priority,
-		&task.Status,
-		&task.Category,
-		&task.DueDate,
-		&task.UserID,
-		&task.Version,
-	)
+	err := m.db().QueryRowContext(ctx, query, id, userID).Scan(taskFields(&task)...)
 	// Handle any errors. If there was no matching task found, Scan() will return a sql.ErrNoRows error.
 	// We check for this and return our custom ErrRecordNotFound error instead.
 	if err != nil {
@@ -103,18 +231,50 @@ func (m TaskModel) Get(id int64) (*Task, error) {
 			return nil, err
 		}
 	}
+	// Work out the progress of the task from its subtasks, if it has any.
+	err = m.attachProgress(ctx, &task)
+	if err != nil {
+		return nil, err
+	}
 	// Otherwise, return a pointer to the Movie struct.
 	return &task, nil
 }
 
-// Add a placeholder method for updating a specific record in the task table.
-func (m TaskModel) Update(task *Task) error {
+// GetIDByICalUID returns the ID of the task that the user imported from the iCalendar
+// to-do with the given UID, or ErrRecordNotFound if they haven't imported it (or it is in
+// the trash).
+func (m TaskModel) GetIDByICalUID(uid string, userID int64) (int64, error) {
+	query := `
+		SELECT id
+		FROM tasks
+		WHERE user_id = $1 AND ical_uid = $2 AND deleted_at IS NULL`
+	var id int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.db().QueryRowContext(ctx, query, userID, uid).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// Update a specific record in the task table on behalf of the user with the given ID.
+// The owner of a task can't be changed here, and an update of a task that the user
+// can't edit is treated in the same way as an edit conflict.
+func (m TaskModel) Update(task *Task, userID int64) error {
 	// Declare the SQL query for updating the record and returning the new version number.
 	query := `
 		UPDATE tasks
-		SET title = $1, description = $2, priority = $3, status = $4, category = $5, due_date = $6, user_id = $7, version = version + 1
-		WHERE id = $8 AND version = $9
-		RETURNING version`
+		SET title = $1, description = $2, priority = $3, status = $4, category = $5, due_date = $6, parent_id = $10,
+			recurrence = $11, recurrence_start = $12, reminder_offsets = $13,
+			started_at = $14, completed_at = $15, project_id = $16, updated_at = NOW(), version = version + 1
+		WHERE id = $7 AND version = $9 AND deleted_at IS NULL AND ` + taskAccessCondition("$8", RoleEditor) + `
+		RETURNING updated_at, version`
 	// Create an args slice containing the values for the placeholder parameters.
 	args := []interface{}{
 		task.Title,
@@ -123,17 +283,50 @@ func (m TaskModel) Update(task *Task) error {
 		task.Status,
 		task.Category,
 		task.DueDate,
-		task.UserID,
 		task.ID,
+		userID,
 		task.Version, // // Add the expected task version
+		task.ParentID,
+		task.Recurrence,
+		task.RecurrenceStart,
+		task.Reminders,
+		task.StartedAt,
+		task.CompletedAt,
+		task.ProjectID,
 	}
 
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	// Update the task, replace its tags and record the change in its history in a single
+	// transaction. The task is locked first, so that the state it is changed from is known.
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getForUpdate(ctx, tx, task.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	// A task which is moved to a new parent is checked again here, under a lock, as the
+	// hierarchy might have changed since the caller validated the parent.
+	if task.ParentID != nil && (before.ParentID == nil || *before.ParentID != *task.ParentID) {
+		err = checkNewParent(ctx, tx, task.ID, *task.ParentID)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Use QueryRowContext() and pass the context as the first argument.
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&task.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&task.UpdatedAt, &task.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -142,26 +335,68 @@ func (m TaskModel) Update(task *Task) error {
 			return err
 		}
 	}
-	return nil
+	err = setTaskTags(ctx, tx, task.ID, task.Tags)
+	if err != nil {
+		return err
+	}
+	after, err := getForUpdate(ctx, tx, task.ID)
+	if err != nil {
+		return err
+	}
+	err = recordHistory(ctx, tx, userID, HistoryUpdate, before, after)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Add a placeholder method for deleting a specific record from the task table.
-func (m TaskModel) Delete(id int64) error {
+// Delete moves a task to the trash, along with all of its subtasks, provided that the
+// user with the given ID holds the owner role on it. Trashed tasks are left out of every
+// other read, and are removed for good by Purge() once they have been in the trash for
+// long enough.
+func (m TaskModel) Delete(id, userID int64) error {
 	// Return an ErrRecordNotFound error if the task ID is less than 1.
 	if id < 1 {
 		return ErrRecordNotFound
 	}
-	// Construct the SQL query to delete the record.
+	// Construct the SQL query to trash the task and its subtree. Every task in the
+	// subtree is marked as deleted with this task, which is how Restore() knows which of
+	// them to bring back together.
 	query := `
-		DELETE FROM tasks
-		WHERE id = $1`
+		WITH RECURSIVE subtree (id) AS (
+			SELECT tasks.id FROM tasks
+			WHERE tasks.id = $1 AND tasks.deleted_at IS NULL AND ` + taskAccessCondition("$2", RoleOwner) + `
+			UNION
+			SELECT tasks.id FROM tasks
+			INNER JOIN subtree ON tasks.parent_id = subtree.id
+			WHERE tasks.deleted_at IS NULL
+		)
+		UPDATE tasks SET deleted_at = NOW(), deleted_with = $1
+		WHERE id IN (SELECT id FROM subtree)`
 
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	// Record the deletion of the task, and of the subtasks which go with it, in the same
+	// transaction as the delete itself.
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = recordDeletion(ctx, tx, id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
 	// Use ExecContext() and pass the context as the first argument.
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -172,39 +407,77 @@ func (m TaskModel) Delete(id int64) error {
 		return err
 	}
 
-	// If no rows were affected,
-	//	we know that the tasks table didn't contain a record with the provided ID at the moment we tried to delete it.
-	// In that case we return an ErrRecordNotFound error.
+	// If no rows were affected, the task doesn't exist, is already in the trash, or
+	// isn't the user's to delete. In that case we return an ErrRecordNotFound error.
 	if rowsAffected == 0 {
 		return ErrRecordNotFound
 	}
-	return nil
+	return tx.Commit()
 }
 
-// Create a new GetAll() method which returns a slice of tasks.
-// Although we're not using them right now, we've set this up to accept the various filter parameters as arguments.
-func (t TaskModel) GetAll(title string, filters Filters) ([]*Task, Metadata, error) {
+// Create a new GetAll() method which returns a slice of the tasks that the user with the given ID
+// can see and which match the query.
+func (t TaskModel) GetAll(q TaskQuery, userID int64, filters Filters) ([]*Task, Metadata, error) {
+	// Build the WHERE clause from the query, using placeholders for all of the values.
+	where := q.conditions(userID)
+
+	// When the query searches for words or phrases, work out how well each task matches
+	// them, and a snippet showing where they appear. Words in the title are weighted more
+	// heavily than those in the description by the search_vector column.
+	rank, headline := "0", "''"
+	if tsquery := q.tsquery(where); tsquery != "" {
+		rank = fmt.Sprintf("ts_rank(tasks.search_vector, %s)", tsquery)
+		headline = fmt.Sprintf(`ts_headline(%s, tasks.title || ' ' || tasks.description, %s,
+			'MaxWords=20, MinWords=5, MaxFragments=2')`, taskSearchConfig, tsquery)
+	}
+
+	// Work out what to sort by, and build the ORDER BY clause from it.
+	keys := taskSortKeys(filters, rank)
+	sortValues := make([]string, len(keys))
+	for i, key := range keys {
+		sortValues[i] = fmt.Sprintf("(%s)::text", key.expr)
+	}
+
+	// In cursor mode, skip the (possibly expensive) total count, and carry on from the
+	// position of the cursor instead of an offset. We fetch one more task than fits on
+	// the page, so that we know whether there is another page after this one.
+	count, limit, offset := "count(*) OVER()", filters.limit(), filters.offset()
+	if filters.UseCursor {
+		count, limit, offset = "0", filters.limit()+1, 0
+		if filters.Cursor != "" {
+			c, err := parseCursor(filters.Cursor, filters.Sort)
+			if err != nil {
+				return nil, Metadata{}, err
+			}
+			where.add(keysetCondition(where, keys, c))
+		}
+	}
+
 	// Update the SQL query to include the window function which counts the total (filtered) records.
+	// The values of the sort keys are read as well, to make the cursor for the next page.
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, description, due_date, priority, status, category, user_id, version
+		SELECT %s, %s, %s, ARRAY[%s]
 		FROM tasks
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+		WHERE %s
+		ORDER BY %s, tasks.id ASC
+		LIMIT %s OFFSET %s`, count, taskColumns, headline, strings.Join(sortValues, ", "), where.String(),
+		orderByClause(keys), where.arg(limit), where.arg(offset))
 
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// As our SQL query now has quite a few placeholder parameters,
-	// let's collect the values for the placeholders in a slice.
+	// The values for the placeholders were collected in where.args as the query was built.
 	// Notice here how we call the limit() and offset() methods on the Filters struct to get the appropriate values
 	//		for the LIMIT and OFFSET clauses.
-	args := []interface{}{title, filters.limit(), filters.offset()}
+	args := where.args
 
 	// And then pass the args slice to QueryContext() as a variadic parameter.
-	rows, err := t.DB.QueryContext(ctx, query, args...)
+	rows, err := t.db().QueryContext(ctx, query, args...)
 	if err != nil {
+		if filters.UseCursor && filters.Cursor != "" {
+			err = cursorQueryError(err)
+		}
 		return nil, Metadata{}, err // Update this to return an empty Metadata struct.
 	}
 
@@ -214,34 +487,26 @@ func (t TaskModel) GetAll(title string, filters Filters) ([]*Task, Metadata, err
 	// Declare a totalRecords variable.
 	totalRecords := 0
 
-	// Initialize an empty slice to hold the movie data.
+	// Initialize an empty slice to hold the movie data, and another for the values of the
+	// sort keys of each one.
 	tasks := []*Task{}
+	var sortValuesByTask []pq.StringArray
 
 	// Use rows.Next to iterate through the rows in the resultset.
 	for rows.Next() {
 		// Initialize an empty Movie struct to hold the data for an individual movie.
 		var task Task
-		// Scan the values from the row into the Movie struct. Again, note that we're
-		// using the pq.Array() adapter on the genres field here.
-		err := rows.Scan(
-			&totalRecords, // Scan the count from the window function into totalRecords.
-			&task.ID,
-			&task.CreatedAt,
-			&task.Title,
-			&task.Description,
-			&task.DueDate,
-			&task.Priority,
-			&task.Status,
-			&task.Category,
-			&task.UserID,
-			&task.Version,
-		)
+		var values pq.StringArray
+		// Scan the values from the row into the Movie struct, reading the count from the
+		// window function into totalRecords first, and the headline and sort values last.
+		err := rows.Scan(append(append([]interface{}{&totalRecords}, taskFields(&task)...), &task.Headline, &values)...)
 		if err != nil {
 			return nil, Metadata{}, err // Update this to return an empty Metadata struct.
 		}
 
 		// Add the Movie struct to the slice.
 		tasks = append(tasks, &task)
+		sortValuesByTask = append(sortValuesByTask, values)
 	}
 
 	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error that was encountered during the iteration.
@@ -250,8 +515,24 @@ func (t TaskModel) GetAll(title string, filters Filters) ([]*Task, Metadata, err
 	}
 
 	// Generate a Metadata struct, passing in the total record count and pagination
-	// parameters from the client.
+	// parameters from the client. In cursor mode there's no total, and if we got the
+	// extra task then it is left off, and the next page carries on from the last task
+	// which is on this one.
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if filters.UseCursor {
+		metadata = Metadata{PageSize: filters.PageSize}
+		if len(tasks) > filters.PageSize {
+			tasks = tasks[:filters.PageSize]
+			last := len(tasks) - 1
+			metadata.NextCursor = cursor{Sort: filters.Sort, Values: sortValuesByTask[last], ID: tasks[last].ID}.String()
+		}
+	}
+
+	// Work out the progress of the tasks on this page which have subtasks.
+	err = t.attachProgress(ctx, tasks...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
 
 	// If everything went OK, then return the slice of movies.
 	return tasks, metadata, nil
@@ -0,0 +1,376 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"math"
+	"time"
+)
+
+// ErrTimerRunning is returned when a user starts a timer while they already have one
+// running.
+var ErrTimerRunning = errors.New("timer already running")
+
+// maxTimeEntryDuration is the longest time that a single entry can cover.
+const maxTimeEntryDuration = 24 * time.Hour
+
+// TimeEntry is a period of time that a user spent on a task. Entries are either added by
+// hand, or made by starting a timer, in which case StoppedAt is nil until the timer is
+// stopped. Seconds is the length of the entry, or for a running timer how long it has
+// been running so far.
+type TimeEntry struct {
+	ID        int64       `json:"id"`
+	CreatedAt CustomTime  `json:"created_at"`
+	TaskID    int64       `json:"task_id"`
+	UserID    int64       `json:"user_id"`
+	StartedAt CustomTime  `json:"started_at"`
+	StoppedAt *CustomTime `json:"stopped_at"`
+	Seconds   int64       `json:"seconds"`
+	Note      string      `json:"note"`
+}
+
+// ValidateTimeEntry checks an entry which is being added by hand, which unlike a timer
+// must have both a start and an end.
+func ValidateTimeEntry(v *validator.Validator, entry *TimeEntry) {
+	v.Check(!entry.StartedAt.IsZero(), "started_at", "must be provided")
+	v.Check(entry.StoppedAt != nil && !entry.StoppedAt.IsZero(), "stopped_at", "must be provided")
+	if !entry.StartedAt.IsZero() && entry.StoppedAt != nil && !entry.StoppedAt.IsZero() {
+		duration := time.Time(*entry.StoppedAt).Sub(time.Time(entry.StartedAt))
+		v.Check(duration > 0, "stopped_at", "must be after started_at")
+		v.Check(duration <= maxTimeEntryDuration, "stopped_at", "must be no more than 24 hours after started_at")
+		v.Check(!entry.StoppedAt.After(time.Now()), "stopped_at", "must not be in the future")
+	}
+	v.Check(len(entry.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
+
+// Define the TimeEntryModel type.
+type TimeEntryModel struct {
+	DB *sql.DB
+}
+
+const timeEntryColumns = `time_entries.id, time_entries.created_at, time_entries.task_id, time_entries.user_id,
+		time_entries.started_at, time_entries.stopped_at,
+		EXTRACT(EPOCH FROM COALESCE(time_entries.stopped_at, NOW()) - time_entries.started_at)::bigint,
+		time_entries.note`
+
+func timeEntryFields(entry *TimeEntry) []interface{} {
+	return []interface{}{
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.TaskID,
+		&entry.UserID,
+		&entry.StartedAt,
+		&entry.StoppedAt,
+		&entry.Seconds,
+		&entry.Note,
+	}
+}
+
+// Insert adds an entry for a period of time which has already finished.
+func (m TimeEntryModel) Insert(entry *TimeEntry) error {
+	query := `
+		INSERT INTO time_entries (task_id, user_id, started_at, stopped_at, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + timeEntryColumns
+	args := []interface{}{entry.TaskID, entry.UserID, entry.StartedAt, entry.StoppedAt, entry.Note}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(timeEntryFields(entry)...)
+}
+
+// StartTimer starts a timer for the user on a task. Each user can only have one timer
+// running at a time, across all of their tasks, and ErrTimerRunning is returned if they
+// already have one.
+func (m TimeEntryModel) StartTimer(taskID, userID int64) (*TimeEntry, error) {
+	query := `
+		INSERT INTO time_entries (task_id, user_id, started_at)
+		VALUES ($1, $2, NOW())
+		RETURNING ` + timeEntryColumns
+	var entry TimeEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, taskID, userID).Scan(timeEntryFields(&entry)...)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "time_entries_running_idx"`:
+			return nil, ErrTimerRunning
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// StopTimer stops the timer that the user has running on a task, returning
+// ErrRecordNotFound if they don't have one running on it.
+func (m TimeEntryModel) StopTimer(taskID, userID int64) (*TimeEntry, error) {
+	query := `
+		UPDATE time_entries
+		SET stopped_at = NOW()
+		WHERE task_id = $1 AND user_id = $2 AND stopped_at IS NULL
+		RETURNING ` + timeEntryColumns
+	var entry TimeEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, taskID, userID).Scan(timeEntryFields(&entry)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// GetRunning returns the timer that the user has running, on whichever task it is.
+func (m TimeEntryModel) GetRunning(userID int64) (*TimeEntry, error) {
+	query := `
+		SELECT ` + timeEntryColumns + `
+		FROM time_entries
+		WHERE user_id = $1 AND stopped_at IS NULL`
+	var entry TimeEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(timeEntryFields(&entry)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// Get returns a specific time entry on a specific task.
+func (m TimeEntryModel) Get(id, taskID int64) (*TimeEntry, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + timeEntryColumns + `
+		FROM time_entries
+		WHERE id = $1 AND task_id = $2`
+	var entry TimeEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, taskID).Scan(timeEntryFields(&entry)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// GetAllForTask returns a page of the time entries on a task, including any timers
+// which are still running.
+func (m TimeEntryModel) GetAllForTask(taskID int64, filters Filters) ([]*TimeEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM time_entries
+		WHERE time_entries.task_id = $1
+		ORDER BY %s, time_entries.id ASC
+		LIMIT $2 OFFSET $3`, timeEntryColumns, filters.orderBy("time_entries"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, taskID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	entries := []*TimeEntry{}
+	for rows.Next() {
+		var entry TimeEntry
+		err := rows.Scan(append([]interface{}{&totalRecords}, timeEntryFields(&entry)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
+
+// Delete removes a time entry from a task.
+func (m TimeEntryModel) Delete(id, taskID int64) error {
+	query := `
+		DELETE FROM time_entries
+		WHERE id = $1 AND task_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, taskID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// TimeReport totals the time tracked over a range of dates, by day, by the category of
+// the tasks and by the user who tracked it. Times are in hours, rounded to two decimal
+// places.
+type TimeReport struct {
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	TotalHours float64            `json:"total_hours"`
+	Days       []TimeReportDay    `json:"days"`
+	Categories []TimeReportBucket `json:"categories"`
+	Users      []TimeReportUser   `json:"users"`
+}
+
+// TimeReportDay is the time tracked on a day, in UTC.
+type TimeReportDay struct {
+	Day   string  `json:"day"`
+	Hours float64 `json:"hours"`
+}
+
+// TimeReportBucket is the time tracked on the tasks in a category.
+type TimeReportBucket struct {
+	Category string  `json:"category"`
+	Hours    float64 `json:"hours"`
+}
+
+// TimeReportUser is the time tracked by a user.
+type TimeReportUser struct {
+	UserID int64   `json:"user_id"`
+	Name   string  `json:"name"`
+	Hours  float64 `json:"hours"`
+}
+
+// TimeReportQuery selects the time entries which go into a report: those which started
+// from From up to, but not including, To, on the tasks that the user can see. If
+// ProjectID isn't zero, only the tasks in that project are included.
+type TimeReportQuery struct {
+	From      time.Time
+	To        time.Time
+	ProjectID int64
+}
+
+// hours converts a number of seconds to hours, rounded to two decimal places.
+func hours(seconds int64) float64 {
+	return math.Round(float64(seconds)/36) / 100
+}
+
+// Report totals the time entries selected by the query. The entries include time that
+// anybody tracked on the tasks, not just the user running the report, so that a task's
+// owner can see the time spent by their collaborators. Running timers aren't counted, and
+// an entry is counted in full on the day that it started.
+func (m TimeEntryModel) Report(q TimeReportQuery, userID int64) (*TimeReport, error) {
+	from := `
+		FROM time_entries
+		INNER JOIN tasks ON tasks.id = time_entries.task_id
+		WHERE time_entries.stopped_at IS NOT NULL
+		AND time_entries.started_at >= $2 AND time_entries.started_at < $3
+		AND ($4::bigint = 0 OR tasks.project_id = $4)
+		AND tasks.deleted_at IS NULL AND ` + taskAccessCondition("$1", RoleViewer)
+	seconds := `SUM(EXTRACT(EPOCH FROM time_entries.stopped_at - time_entries.started_at))::bigint`
+	args := []interface{}{userID, q.From, q.To, q.ProjectID}
+
+	report := &TimeReport{
+		From: q.From.Format("2006-01-02"),
+		// The report gives the last day that it covers, rather than the day after.
+		To:         q.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		Days:       []TimeReportDay{},
+		Categories: []TimeReportBucket{},
+		Users:      []TimeReportUser{},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Each of the totals is read by a query of its own. The total of all the entries
+	// is the sum of the days.
+	query := `
+		SELECT to_char(time_entries.started_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS entry_day, ` + seconds + from + `
+		GROUP BY entry_day
+		ORDER BY entry_day`
+	var total int64
+	err := m.scanReport(ctx, query, args, func(rows *sql.Rows) error {
+		var day TimeReportDay
+		var s int64
+		if err := rows.Scan(&day.Day, &s); err != nil {
+			return err
+		}
+		day.Hours = hours(s)
+		total += s
+		report.Days = append(report.Days, day)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.TotalHours = hours(total)
+
+	query = `
+		SELECT tasks.category, ` + seconds + from + `
+		GROUP BY tasks.category
+		ORDER BY tasks.category`
+	err = m.scanReport(ctx, query, args, func(rows *sql.Rows) error {
+		var bucket TimeReportBucket
+		var s int64
+		if err := rows.Scan(&bucket.Category, &s); err != nil {
+			return err
+		}
+		bucket.Hours = hours(s)
+		report.Categories = append(report.Categories, bucket)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT users.id, users.name, totals.seconds
+		FROM (SELECT time_entries.user_id, ` + seconds + ` AS seconds` + from + `
+			GROUP BY time_entries.user_id) AS totals
+		INNER JOIN users ON users.id = totals.user_id
+		ORDER BY users.name, users.id`
+	err = m.scanReport(ctx, query, args, func(rows *sql.Rows) error {
+		var user TimeReportUser
+		var s int64
+		if err := rows.Scan(&user.UserID, &user.Name, &s); err != nil {
+			return err
+		}
+		user.Hours = hours(s)
+		report.Users = append(report.Users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// scanReport runs one of the queries for a report, calling scan for each row.
+func (m TimeEntryModel) scanReport(ctx context.Context, query string, args []interface{}, scan func(*sql.Rows) error) error {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -12,9 +12,12 @@ import (
 
 // Define constants for the token scope. For now we just define the scope "activation"
 // but we'll add additional scopes later in the book.
+// The calendar scope is for the secret in the URL of a user's iCalendar feed, which lets
+// calendar applications read their tasks without logging in.
 const (
 	ScopeActivation      = "activation"
 	ScopeAuthentications = "authentication"
+	ScopeCalendar        = "calendar"
 )
 
 // Add struct tags to control how the struct appears when encoded to JSON.
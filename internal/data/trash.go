@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+// Define a custom ErrParentInTrash error, returned when restoring a subtask whose parent
+// is still in the trash.
+var (
+	ErrParentInTrash = errors.New("parent task is in the trash")
+)
+
+// GetTrash returns a page of the trashed tasks which the user with the given ID could
+// restore, that is those on which they hold the owner role.
+func (m TaskModel) GetTrash(userID int64, filters Filters) ([]*Task, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM tasks
+		WHERE tasks.deleted_at IS NOT NULL AND %s
+		ORDER BY %s, tasks.id ASC
+		LIMIT $2 OFFSET $3`, taskColumns, taskAccessCondition("$1", RoleOwner), filters.orderBy("tasks"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.db().QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	tasks := []*Task{}
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(append([]interface{}{&totalRecords}, taskFields(&task)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return tasks, metadata, nil
+}
+
+// Restore takes a task out of the trash, together with the subtasks which were trashed
+// along with it, provided that the user with the given ID holds the owner role on it.
+// A subtask can't be restored while its parent is still in the trash, as it would be
+// left hanging off a task that nobody can see.
+func (m TaskModel) Restore(id, userID int64) (*Task, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the task and the subtasks which were trashed along with it, reading the task
+	// first. Subtasks which were trashed on their own stay in the trash, even if that
+	// happened in the same second.
+	query := `
+		WITH RECURSIVE subtree (id, depth) AS (
+			SELECT tasks.id, 0 FROM tasks
+			WHERE tasks.id = $1 AND tasks.deleted_at IS NOT NULL AND ` + taskAccessCondition("$2", RoleOwner) + `
+			UNION ALL
+			SELECT tasks.id, subtree.depth + 1 FROM tasks
+			INNER JOIN subtree ON tasks.parent_id = subtree.id
+			WHERE tasks.deleted_with = (SELECT deleted_with FROM tasks WHERE id = $1)
+				AND subtree.depth < ` + strconv.Itoa(maxTaskDepth) + `
+		)
+		SELECT ` + taskColumns + `
+		FROM tasks
+		INNER JOIN subtree ON subtree.id = tasks.id
+		ORDER BY subtree.depth, tasks.id
+		FOR UPDATE OF tasks`
+	rows, err := tx.QueryContext(ctx, query, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		tasks []*Task
+		ids   []int64
+	)
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(taskFields(&task)...)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+		ids = append(ids, task.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	root := tasks[0]
+	if root.ParentID != nil {
+		var parentTrashed bool
+		query = `SELECT deleted_at IS NOT NULL FROM tasks WHERE id = $1`
+		err = tx.QueryRowContext(ctx, query, *root.ParentID).Scan(&parentTrashed)
+		if err != nil {
+			return nil, err
+		}
+		if parentTrashed {
+			return nil, ErrParentInTrash
+		}
+	}
+
+	// A task imported from an iCalendar to-do stops being linked to it if the to-do has
+	// been imported again since the task was trashed, so that the restored task doesn't
+	// clash with the newer one.
+	query = `
+		UPDATE tasks SET deleted_at = NULL, deleted_with = NULL, updated_at = NOW(),
+			ical_uid = CASE WHEN EXISTS (
+				SELECT 1 FROM tasks AS live
+				WHERE live.user_id = tasks.user_id AND live.ical_uid = tasks.ical_uid AND live.deleted_at IS NULL
+			) THEN NULL ELSE tasks.ical_uid END
+		WHERE id = ANY($1)`
+	_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		restored := *task
+		restored.DeletedAt = nil
+		err = recordHistory(ctx, tx, userID, HistoryRestore, task, &restored)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	root.DeletedAt = nil
+	return root, nil
+}
+
+// Purge permanently deletes the tasks which were moved to the trash before the given time.
+// It returns the storage keys of the files which were attached to them, which the caller
+// should remove from storage.
+func (m TaskModel) Purge(before time.Time) (int64, []string, error) {
+	// The outer SELECT sees the attachments as they were before the DELETE cascaded to
+	// them, so their storage keys can be collected in the same statement.
+	query := `
+		WITH purged AS (
+			DELETE FROM tasks WHERE deleted_at < $1
+			RETURNING id
+		)
+		SELECT (SELECT count(*) FROM purged), task_attachments.storage_key
+		FROM (SELECT 1) AS one
+		LEFT JOIN task_attachments ON task_attachments.task_id IN (SELECT id FROM purged)`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	rows, err := m.db().QueryContext(ctx, query, before)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	var (
+		purged int64
+		keys   []string
+	)
+	for rows.Next() {
+		var key sql.NullString
+		err := rows.Scan(&purged, &key)
+		if err != nil {
+			return 0, nil, err
+		}
+		if key.Valid {
+			keys = append(keys, key.String)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	return purged, keys, nil
+}
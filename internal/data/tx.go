@@ -0,0 +1,85 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx, so that the same query code can run
+// either straight on the connection pool or as part of a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// WithTx returns a copy of the model which runs all of its queries on the transaction.
+// Methods which would normally use a transaction of their own, such as Insert(), join
+// the given one instead, and committing it or rolling it back is up to the caller.
+func (m TaskModel) WithTx(tx *sql.Tx) TaskModel {
+	m.tx = tx
+	return m
+}
+
+// db returns what the model should run its queries on.
+func (m TaskModel) db() querier {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// WithTx returns a copy of the model which runs all of its queries on the transaction.
+func (m ProjectModel) WithTx(tx *sql.Tx) ProjectModel {
+	m.tx = tx
+	return m
+}
+
+func (m ProjectModel) db() querier {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// WithTx returns a copy of the models in which the models that support transactions, the
+// tasks and the projects, run their queries on the transaction. Checks made on behalf of a
+// change to tasks then see the changes made earlier in the same transaction.
+func (m Models) WithTx(tx *sql.Tx) Models {
+	m.Tasks = m.Tasks.WithTx(tx)
+	m.Projects = m.Projects.WithTx(tx)
+	return m
+}
+
+// txn is the transaction used by a TaskModel method which makes several changes at once.
+// If the model was bound to a transaction with WithTx(), that transaction is used, and
+// Commit() and Rollback() do nothing.
+type txn struct {
+	*sql.Tx
+	owned bool
+}
+
+func (m TaskModel) beginTx(ctx context.Context) (txn, error) {
+	if m.tx != nil {
+		return txn{Tx: m.tx}, nil
+	}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return txn{}, err
+	}
+	return txn{Tx: tx, owned: true}, nil
+}
+
+func (t txn) Commit() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t txn) Rollback() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
@@ -31,6 +31,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Language  string    `json:"language"` // Language used for full-text search, one of SearchLanguages
 	Version   int       `json:"-"`
 }
 
@@ -93,6 +94,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
 	// Call the standalone ValidateEmail() helper.
 	ValidateEmail(v, user.Email)
+	v.Check(validator.In(user.Language, SearchLanguages...), "language", "must be a supported language")
 	// If the plaintext password is not nil, call the standalone
 	// ValidatePasswordPlaintext() helper.
 	if user.Password.plaintext != nil {
@@ -118,10 +120,10 @@ type UserModel struct {
 // that we did when creating a movie.
 func (m UserModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (name, email, password_hash, activated, language)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, version`
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated, user.Language}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	// If the table already contains a record with this email address, then when we try
@@ -145,7 +147,7 @@ func (m UserModel) Insert(user *User) error {
 // return one record (or none at all, in which case we return a ErrRecordNotFound error).
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, language, version
 		FROM users
 		WHERE email = $1`
 	var user User
@@ -158,6 +160,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Language,
 		&user.Version,
 	)
 	if err != nil {
@@ -175,18 +178,27 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 // field to help prevent any race conditions during the request cycle, just like we did
 // when updating a movie. And we also check for a violation of the "users_email_key"
 // constraint when performing the update, just like we did when inserting the user
-// record originally.
+// record originally. If the user's language changes, their tasks are indexed for
+// full-text search in the new language, in the same statement.
 func (m UserModel) Update(user *User) error {
 	query := `
-		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
-		RETURNING version`
+		WITH updated AS (
+			UPDATE users
+			SET name = $1, email = $2, password_hash = $3, activated = $4, language = $5, version = version + 1
+			WHERE id = $6 AND version = $7
+			RETURNING id, language, version
+		), reindexed AS (
+			UPDATE tasks SET language = updated.language::regconfig
+			FROM updated
+			WHERE tasks.user_id = updated.id AND tasks.language <> updated.language::regconfig
+		)
+		SELECT version FROM updated`
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Language,
 		user.ID,
 		user.Version,
 	}
@@ -212,7 +224,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	// Set up the SQL query.
 	query := `
-SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.language, users.version
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -236,6 +248,7 @@ AND tokens.expiry > $3`
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Language,
 		&user.Version,
 	)
 	if err != nil {
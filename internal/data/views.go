@@ -0,0 +1,333 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"net/url"
+	"time"
+)
+
+// View is a saved set of filters and a sort for listing tasks, so that a user doesn't
+// have to build the same query every time. Its owner can share it with other users, who
+// can run it but not change it.
+type View struct {
+	ID        int64       `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UserID    int64       `json:"user_id"` // ID of the user who owns the view
+	Name      string      `json:"name"`
+	Filters   ViewFilters `json:"filters"`
+	Version   int32       `json:"version"`
+}
+
+// ViewFilters holds the query string parameters of GET /v1/tasks that a view runs with,
+// such as {"status": "to-do,in-progress", "sort": "-priority,due_date"}. Only the
+// parameters in ViewParameters can be saved.
+type ViewFilters map[string]string
+
+// ViewParameters lists the parameters of GET /v1/tasks which can be saved in a view. The
+// pagination parameters are left out, as they're given each time the view is run.
+var ViewParameters = []string{"title", "tags", "tags_mode", "project", "include_archived", "status", "priority",
+	"category", "owner", "due_after", "due_before", "created_after", "created_before", "overdue", "q", "sort"}
+
+// Values returns the filters as a url.Values map, in the same form as they'd be read from
+// the query string.
+func (f ViewFilters) Values() url.Values {
+	qs := make(url.Values, len(f))
+	for key, value := range f {
+		qs.Set(key, value)
+	}
+	return qs
+}
+
+// Implement the database/sql/driver Valuer interface to store the filters as JSON.
+func (f ViewFilters) Value() (driver.Value, error) {
+	if f == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(f)
+}
+
+// Implement the database/sql Scanner interface to read the filters back from JSON.
+func (f *ViewFilters) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ViewFilters", src)
+	}
+	return json.Unmarshal(b, f)
+}
+
+// ValidateView checks the name of the view and that it only saves the parameters which
+// are allowed. The values of the parameters are checked by the handlers, in the same way
+// as they are when listing tasks.
+func ValidateView(v *validator.Validator, view *View) {
+	v.Check(view.Name != "", "name", "must be provided")
+	v.Check(len(view.Name) <= 200, "name", "must not be more than 200 bytes long")
+	for key, value := range view.Filters {
+		v.Check(validator.In(key, ViewParameters...), "filters", fmt.Sprintf("must not contain the parameter %q", key))
+		v.Check(len(value) <= 1000, "filters", fmt.Sprintf("must not have a value of more than 1000 bytes for %s", key))
+	}
+}
+
+// viewAccessCondition works like taskAccessCondition(), for the views that the user owns
+// or which have been shared with them.
+func viewAccessCondition(placeholder string) string {
+	return fmt.Sprintf(`(views.user_id = %[1]s OR EXISTS (
+				SELECT 1 FROM view_shares
+				WHERE view_shares.view_id = views.id
+				AND view_shares.user_id = %[1]s))`, placeholder)
+}
+
+// Define the ViewModel type.
+type ViewModel struct {
+	DB *sql.DB
+}
+
+const viewColumns = `views.id, views.created_at, views.user_id, views.name, views.filters, views.version`
+
+func viewFields(view *View) []interface{} {
+	return []interface{}{
+		&view.ID,
+		&view.CreatedAt,
+		&view.UserID,
+		&view.Name,
+		&view.Filters,
+		&view.Version,
+	}
+}
+
+func (m ViewModel) Insert(view *View) error {
+	query := `
+		INSERT INTO views (user_id, name, filters)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+	args := []interface{}{view.UserID, view.Name, view.Filters}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&view.ID, &view.CreatedAt, &view.Version)
+}
+
+// Get returns a specific view, provided that the user with the given ID owns it or it has
+// been shared with them.
+func (m ViewModel) Get(id, userID int64) (*View, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + viewColumns + `
+		FROM views
+		WHERE views.id = $1 AND ` + viewAccessCondition("$2")
+	var view View
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(viewFields(&view)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &view, nil
+}
+
+// GetAll returns the views that the user owns, together with those which have been
+// shared with them.
+func (m ViewModel) GetAll(userID int64, filters Filters) ([]*View, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM views
+		WHERE %s
+		ORDER BY %s, views.id ASC
+		LIMIT $2 OFFSET $3`, viewColumns, viewAccessCondition("$1"), filters.orderBy("views"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	views := []*View{}
+	for rows.Next() {
+		var view View
+		err := rows.Scan(append([]interface{}{&totalRecords}, viewFields(&view)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		views = append(views, &view)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return views, metadata, nil
+}
+
+// Update saves the changes to a view, using the version number to detect edit conflicts
+// in the same way as TaskModel.Update().
+func (m ViewModel) Update(view *View) error {
+	query := `
+		UPDATE views
+		SET name = $1, filters = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+	args := []interface{}{view.Name, view.Filters, view.ID, view.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&view.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a view, and stops sharing it with anybody.
+func (m ViewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM views
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetRole returns the role that the user holds on a view, and whether they are its owner,
+// in the same way as TaskModel.GetRole(). The owner holds the owner role, and users that
+// the view has been shared with hold the viewer role.
+func (m ViewModel) GetRole(id, userID int64) (string, bool, error) {
+	if id < 1 {
+		return "", false, ErrRecordNotFound
+	}
+	query := `
+		SELECT views.user_id = $2
+		FROM views
+		LEFT JOIN view_shares ON view_shares.view_id = views.id AND view_shares.user_id = $2
+		WHERE views.id = $1 AND (views.user_id = $2 OR view_shares.user_id IS NOT NULL)`
+	var owner bool
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&owner)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", false, ErrRecordNotFound
+		default:
+			return "", false, err
+		}
+	}
+	if owner {
+		return RoleOwner, true, nil
+	}
+	return RoleViewer, false, nil
+}
+
+// ViewShare represents a user who a view has been shared with.
+type ViewShare struct {
+	ViewID    int64     `json:"view_id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Define the ViewShareModel type.
+type ViewShareModel struct {
+	DB *sql.DB
+}
+
+// Insert shares the view with the user. Sharing it with the same user again leaves the
+// existing share in place.
+func (m ViewShareModel) Insert(share *ViewShare) error {
+	query := `
+		INSERT INTO view_shares (view_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (view_id, user_id) DO UPDATE SET view_id = EXCLUDED.view_id
+		RETURNING created_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, share.ViewID, share.UserID).Scan(&share.CreatedAt)
+}
+
+// GetAllForView returns the users that a view has been shared with, in the order it was
+// shared with them.
+func (m ViewShareModel) GetAllForView(viewID int64) ([]*ViewShare, error) {
+	query := `
+		SELECT view_shares.view_id, users.id, users.name, users.email, view_shares.created_at
+		FROM view_shares
+		INNER JOIN users ON users.id = view_shares.user_id
+		WHERE view_shares.view_id = $1
+		ORDER BY view_shares.created_at, users.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, viewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []*ViewShare{}
+	for rows.Next() {
+		var share ViewShare
+		err := rows.Scan(
+			&share.ViewID,
+			&share.UserID,
+			&share.Name,
+			&share.Email,
+			&share.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, &share)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// Delete stops sharing a view with the user, returning ErrRecordNotFound if it wasn't
+// shared with them in the first place.
+func (m ViewShareModel) Delete(viewID, userID int64) error {
+	query := `
+		DELETE FROM view_shares
+		WHERE view_id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, viewID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"fmt"
+	"github.com/Bayashat/TaskNinja/internal/validator"
+	"strings"
+	"time"
+)
+
+// Statuses lists the states of the task workflow, in the order that work moves through
+// them. The tasks_status_check constraint in the database allows exactly these values.
+var Statuses = []string{StatusTodo, StatusInProgress, StatusCompleted}
+
+// Workflow maps each status to the statuses that a task is allowed to move to next.
+type Workflow map[string][]string
+
+// DefaultWorkflow lets work move forwards through the statuses (skipping straight to
+// completed if need be), step back from in-progress, and reopen completed tasks.
+var DefaultWorkflow = Workflow{
+	StatusTodo:       {StatusInProgress, StatusCompleted},
+	StatusInProgress: {StatusTodo, StatusCompleted},
+	StatusCompleted:  {StatusTodo, StatusInProgress},
+}
+
+// ParseWorkflow parses a workflow from a space-separated list of transitions, each in
+// the form "from:to1,to2". For example:
+//
+//	to-do:in-progress in-progress:completed completed:to-do
+//
+// Statuses that aren't listed on the left of any transition have no way out.
+func ParseWorkflow(value string) (Workflow, error) {
+	workflow := make(Workflow)
+	for _, transition := range strings.Fields(value) {
+		from, to, found := strings.Cut(transition, ":")
+		if !found || to == "" {
+			return nil, fmt.Errorf("transition %q must be in the form from:to1,to2", transition)
+		}
+		if !validator.In(from, Statuses...) {
+			return nil, fmt.Errorf("unknown status %q", from)
+		}
+		for _, status := range strings.Split(to, ",") {
+			if !validator.In(status, Statuses...) {
+				return nil, fmt.Errorf("unknown status %q", status)
+			}
+			workflow[from] = append(workflow[from], status)
+		}
+	}
+	return workflow, nil
+}
+
+// Allows reports whether a task may move from one status to another. Staying in the same
+// status is always allowed.
+func (w Workflow) Allows(from, to string) bool {
+	return from == to || validator.In(to, w[from]...)
+}
+
+// ValidateStatusTransition checks that the workflow allows a task to move between two
+// statuses, and if not explains which statuses it could move to instead.
+func ValidateStatusTransition(v *validator.Validator, workflow Workflow, from, to string) {
+	if workflow.Allows(from, to) {
+		return
+	}
+	next := "none"
+	if len(workflow[from]) > 0 {
+		next = strings.Join(workflow[from], ", ")
+	}
+	v.AddError("status", fmt.Sprintf("cannot move from %s to %s; allowed next states: %s", from, to, next))
+}
+
+// SetStatus moves the task to a new status, recording when it was started and completed.
+// Reopening a completed task clears its completion time.
+func (t *Task) SetStatus(status string, now time.Time) {
+	if status == t.Status {
+		return
+	}
+	at := CustomTime(now)
+	switch status {
+	case StatusInProgress:
+		if t.StartedAt == nil {
+			t.StartedAt = &at
+		}
+		t.CompletedAt = nil
+	case StatusCompleted:
+		t.CompletedAt = &at
+	default:
+		t.CompletedAt = nil
+	}
+	t.Status = status
+}
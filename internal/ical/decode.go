@@ -0,0 +1,334 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyntaxError reports a calendar which can't be read, along with the number of the line
+// in the input that the problem was found on.
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// maxLineLength is the longest (unfolded) content line that Decode() accepts.
+const maxLineLength = 1 << 20
+
+// Decode reads an iCalendar document and returns the to-dos in it. Events (VEVENT
+// components) are returned as to-dos too, which are due when the event ends, or when it
+// starts if it has no end. Other components, such as time zone definitions, are skipped,
+// and so are the properties that Todo doesn't hold. Times given in a time zone that isn't
+// known on this system, and floating times which aren't tied to a time zone, are read as
+// UTC.
+func Decode(r io.Reader) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	cal := &Calendar{}
+	var (
+		stack   []string
+		todo    *Todo
+		started bool
+		// start is the start of the event being read, which it's due at if it doesn't
+		// have an end.
+		start time.Time
+	)
+	for _, line := range lines {
+		if line.text == "" {
+			continue
+		}
+		number := line.number
+		p, err := parseLine(line.text)
+		if err != nil {
+			return nil, &SyntaxError{number, err.Error()}
+		}
+
+		switch p.name {
+		case "BEGIN":
+			component := strings.ToUpper(p.value)
+			if len(stack) == 0 && component != "VCALENDAR" {
+				return nil, &SyntaxError{number, "calendar must start with BEGIN:VCALENDAR"}
+			}
+			stack = append(stack, component)
+			started = true
+			if (component == "VTODO" || component == "VEVENT") && len(stack) == 2 {
+				todo = &Todo{}
+				start = time.Time{}
+			}
+			continue
+		case "END":
+			component := strings.ToUpper(p.value)
+			if len(stack) == 0 || stack[len(stack)-1] != component {
+				return nil, &SyntaxError{number, fmt.Sprintf("unexpected END:%s", p.value)}
+			}
+			stack = stack[:len(stack)-1]
+			if (component == "VTODO" || component == "VEVENT") && todo != nil && len(stack) == 1 {
+				if component == "VEVENT" && todo.Due.IsZero() {
+					todo.Due = start
+				}
+				cal.Todos = append(cal.Todos, *todo)
+				todo = nil
+			}
+			continue
+		}
+		if len(stack) == 0 {
+			return nil, &SyntaxError{number, "calendar must start with BEGIN:VCALENDAR"}
+		}
+
+		switch stack[len(stack)-1] {
+		case "VCALENDAR":
+			switch p.name {
+			case "PRODID":
+				cal.ProdID = p.value
+			case "X-WR-CALNAME":
+				cal.Name = unescapeText(p.value)
+			}
+		case "VTODO":
+			// Properties of components nested in a to-do, such as alarms, are ignored
+			// along with the rest of those components.
+			if todo == nil {
+				continue
+			}
+			err = todo.set(p)
+			if err != nil {
+				return nil, &SyntaxError{number, fmt.Sprintf("%s: %s", p.name, err)}
+			}
+		case "VEVENT":
+			if todo == nil {
+				continue
+			}
+			switch p.name {
+			case "DTEND":
+				todo.Due, err = parseTime(p)
+			case "DTSTART":
+				start, err = parseTime(p)
+			case "DUE", "COMPLETED":
+				// These are properties of to-dos, which events don't have.
+			default:
+				err = todo.set(p)
+			}
+			if err != nil {
+				return nil, &SyntaxError{number, fmt.Sprintf("%s: %s", p.name, err)}
+			}
+		}
+	}
+	if !started {
+		return nil, &SyntaxError{1, "calendar must start with BEGIN:VCALENDAR"}
+	}
+	if len(stack) > 0 {
+		return nil, &SyntaxError{lines[len(lines)-1].number, fmt.Sprintf("missing END:%s", stack[len(stack)-1])}
+	}
+	return cal, nil
+}
+
+// set stores the value of a property of a to-do.
+func (t *Todo) set(p property) error {
+	var err error
+	switch p.name {
+	case "UID":
+		t.UID = unescapeText(p.value)
+	case "DTSTAMP":
+		t.Stamp, err = parseTime(p)
+	case "CREATED":
+		t.Created, err = parseTime(p)
+	case "LAST-MODIFIED":
+		t.LastModified, err = parseTime(p)
+	case "SUMMARY":
+		t.Summary = unescapeText(p.value)
+	case "DESCRIPTION":
+		t.Description = unescapeText(p.value)
+	case "DUE":
+		t.Due, err = parseTime(p)
+	case "COMPLETED":
+		t.Completed, err = parseTime(p)
+	case "PRIORITY":
+		t.Priority, err = strconv.Atoi(p.value)
+		if err != nil || t.Priority < 0 || t.Priority > 9 {
+			return errors.New("must be an integer between 0 and 9")
+		}
+	case "STATUS":
+		t.Status = strings.ToUpper(p.value)
+	case "CATEGORIES":
+		// CATEGORIES can be given more than once, and each can hold a list of values.
+		for _, category := range splitList(p.value) {
+			if category = strings.TrimSpace(unescapeText(category)); category != "" {
+				t.Categories = append(t.Categories, category)
+			}
+		}
+	case "RRULE":
+		t.RRule = p.value
+	}
+	return err
+}
+
+// line is an unfolded content line, and the number of the line in the input that it
+// started on.
+type line struct {
+	text   string
+	number int
+}
+
+// unfold reads the content lines of a calendar, joining lines which were folded onto the
+// line before them. Both CRLF and bare LF line endings are accepted.
+func unfold(r io.Reader) ([]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	var lines []line
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) > 0 && text != "" && (text[0] == ' ' || text[0] == '\t') {
+			last := &lines[len(lines)-1]
+			if len(last.text)+len(text) > maxLineLength {
+				return nil, &SyntaxError{last.number, "line is too long"}
+			}
+			last.text += text[1:]
+			continue
+		}
+		lines = append(lines, line{text: text, number: number})
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, &SyntaxError{number + 1, "line is too long"}
+		}
+		return nil, err
+	}
+	return lines, nil
+}
+
+// property is a parsed content line, with the name and parameter names in upper case.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseLine splits a content line into its name, parameters and value. Parameter values
+// can be quoted, in which case they may contain the ";", ":" and "," characters.
+func parseLine(s string) (property, error) {
+	p := property{params: map[string]string{}}
+	i := strings.IndexAny(s, ";:")
+	if i <= 0 {
+		return p, errors.New("content line must have a name followed by a colon and a value")
+	}
+	p.name = strings.ToUpper(s[:i])
+	s = s[i:]
+	for s[0] == ';' {
+		s = s[1:]
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return p, fmt.Errorf("%s: parameter must have a name and a value", p.name)
+		}
+		name := strings.ToUpper(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return p, fmt.Errorf("%s: parameter %s has an unterminated quoted value", p.name, name)
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexAny(s, ";:")
+			if end < 0 {
+				break
+			}
+			value, s = s[:end], s[end:]
+		}
+		p.params[name] = value
+		if s == "" {
+			break
+		}
+	}
+	if s == "" || s[0] != ':' {
+		return p, fmt.Errorf("%s: content line must have a colon before its value", p.name)
+	}
+	p.value = s[1:]
+	return p, nil
+}
+
+// parseTime reads a DATE or DATE-TIME value. Dates are read as midnight UTC on that day.
+func parseTime(p property) (time.Time, error) {
+	value := p.value
+	// Only the first of a list of times is used.
+	if i := strings.IndexByte(value, ','); i >= 0 {
+		value = value[:i]
+	}
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(value) == len("20060102") {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, errors.New("must be a date in the form YYYYMMDD")
+		}
+		return t, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, errors.New("must be a date-time in the form YYYYMMDDTHHMMSS")
+		}
+		return t, nil
+	}
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, errors.New("must be a date-time in the form YYYYMMDDTHHMMSS")
+	}
+	return t, nil
+}
+
+// splitList splits a list of TEXT values on the commas which aren't escaped.
+func splitList(s string) []string {
+	var (
+		values []string
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, s[start:])
+}
+
+// unescapeText reverses escapeText().
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
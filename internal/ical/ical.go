@@ -0,0 +1,152 @@
+// Package ical reads and writes the parts of iCalendar (RFC 5545) that we need to
+// exchange tasks with calendar applications, which is calendars of to-dos (VTODO
+// components).
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Define the values of the STATUS property of a to-do.
+const (
+	StatusNeedsAction = "NEEDS-ACTION"
+	StatusInProcess   = "IN-PROCESS"
+	StatusCompleted   = "COMPLETED"
+	StatusCancelled   = "CANCELLED"
+)
+
+// Calendar is an iCalendar object holding a list of to-dos.
+type Calendar struct {
+	// ProdID identifies the product which created the calendar.
+	ProdID string
+	// Name is shown by calendar applications as the name of the calendar, using the
+	// widely supported X-WR-CALNAME extension property.
+	Name  string
+	Todos []Todo
+}
+
+// Todo is a VTODO component. Zero values are left out when it is written.
+type Todo struct {
+	UID          string
+	Stamp        time.Time
+	Created      time.Time
+	LastModified time.Time
+	Summary      string
+	Description  string
+	Due          time.Time
+	Completed    time.Time
+	// Priority runs from 1 (the highest) to 9 (the lowest), with 0 meaning that the
+	// priority is undefined.
+	Priority   int
+	Status     string
+	Categories []string
+	// RRule is the recurrence rule of the to-do, without the "RRULE:" prefix.
+	RRule string
+}
+
+// Encode writes the calendar to w in iCalendar format, with lines folded and ended by
+// CRLF as RFC 5545 requires.
+func Encode(w io.Writer, cal *Calendar) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", cal.ProdID)
+	e.line("CALSCALE", "GREGORIAN")
+	if cal.Name != "" {
+		e.line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	for _, todo := range cal.Todos {
+		e.todo(&todo)
+	}
+	e.line("END", "VCALENDAR")
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// encoder writes the content lines of a calendar, keeping the first error.
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) todo(t *Todo) {
+	e.line("BEGIN", "VTODO")
+	e.line("UID", escapeText(t.UID))
+	e.line("DTSTAMP", formatTime(t.Stamp))
+	if !t.Created.IsZero() {
+		e.line("CREATED", formatTime(t.Created))
+	}
+	if !t.LastModified.IsZero() {
+		e.line("LAST-MODIFIED", formatTime(t.LastModified))
+	}
+	e.line("SUMMARY", escapeText(t.Summary))
+	if t.Description != "" {
+		e.line("DESCRIPTION", escapeText(t.Description))
+	}
+	if !t.Due.IsZero() {
+		e.line("DUE", formatTime(t.Due))
+	}
+	if !t.Completed.IsZero() {
+		e.line("COMPLETED", formatTime(t.Completed))
+	}
+	if t.Priority != 0 {
+		e.line("PRIORITY", strconv.Itoa(t.Priority))
+	}
+	if t.Status != "" {
+		e.line("STATUS", t.Status)
+	}
+	if len(t.Categories) > 0 {
+		categories := make([]string, len(t.Categories))
+		for i, category := range t.Categories {
+			categories[i] = escapeText(category)
+		}
+		e.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	if t.RRule != "" {
+		e.line("RRULE", t.RRule)
+	}
+	e.line("END", "VTODO")
+}
+
+// line writes a content line, folding it so that no line is longer than 75 octets. The
+// continuation lines start with a space, and multi-octet UTF-8 characters are never split.
+func (e *encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+	s := name + ":" + value
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		_, e.err = e.w.WriteString(s[:cut] + "\r\n ")
+		if e.err != nil {
+			return
+		}
+		s = s[cut:]
+		// Continuation lines have one octet less, to leave room for the space.
+		limit = 74
+	}
+	_, e.err = e.w.WriteString(s + "\r\n")
+}
+
+// formatTime formats a time as an iCalendar DATE-TIME in UTC.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeText escapes the characters which have a special meaning in a TEXT value.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
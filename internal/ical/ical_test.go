@@ -0,0 +1,328 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// calendar wraps content lines in a VCALENDAR, ending each line with CRLF.
+func calendar(lines ...string) string {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Test//EN"}, lines...)
+	all = append(all, "END:VCALENDAR")
+	return strings.Join(all, "\r\n") + "\r\n"
+}
+
+func TestEncodeDecode(t *testing.T) {
+	cal := &Calendar{
+		ProdID: "-//TaskNinja//Tasks//EN",
+		Name:   "Work, home; and everything else",
+		Todos: []Todo{
+			{
+				UID:          "1@taskninja",
+				Stamp:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Created:      time.Date(2023, 12, 1, 9, 0, 0, 0, time.UTC),
+				LastModified: time.Date(2023, 12, 2, 9, 0, 0, 0, time.UTC),
+				Summary:      strings.Repeat("Überprüfung der Änderungen ", 10),
+				Description:  "First line\nSecond line, with a comma; a semicolon and a \\ backslash",
+				Due:          time.Date(2024, 2, 29, 17, 30, 0, 0, time.UTC),
+				Completed:    time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC),
+				Priority:     1,
+				Status:       StatusCompleted,
+				Categories:   []string{"work", "side, project"},
+				RRule:        "FREQ=WEEKLY;BYDAY=MO,TH",
+			},
+			{
+				UID:     "2@taskninja",
+				Stamp:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Summary: "Minimal",
+				Status:  StatusNeedsAction,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err := Encode(&buf, cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.String()
+	if !strings.HasSuffix(encoded, "END:VCALENDAR\r\n") {
+		t.Errorf("encoded calendar doesn't end with a CRLF-terminated END:VCALENDAR")
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(encoded, "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line is %d octets long: %q", len(l), l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("line splits a UTF-8 character: %q", l)
+		}
+		if strings.Contains(l, "\n") {
+			t.Errorf("line contains a bare LF: %q", l)
+		}
+	}
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cal) {
+		t.Errorf("Decode(Encode(cal)) = %+v, want %+v", got, cal)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  []Todo
+	}{
+		{
+			name: "folded lines",
+			input: calendar(
+				"BEGIN:VTODO",
+				"SUMMARY:Write the",
+				"  release notes",
+				"DESCRIPTION:a",
+				"\tb",
+				"END:VTODO",
+			),
+			want: []Todo{{Summary: "Write the release notes", Description: "ab"}},
+		},
+		{
+			name:  "bare LF line endings",
+			input: "BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:a\n b\nEND:VTODO\nEND:VCALENDAR\n",
+			want:  []Todo{{Summary: "ab"}},
+		},
+		{
+			name: "text escapes",
+			input: calendar(
+				"BEGIN:VTODO",
+				`SUMMARY:a\, b\; c\\d\ne\Nf`,
+				`CATEGORIES:one\,two,three`,
+				`CATEGORIES:four`,
+				"END:VTODO",
+			),
+			want: []Todo{{Summary: "a, b; c\\d\ne\nf", Categories: []string{"one,two", "three", "four"}}},
+		},
+		{
+			name: "dates and date-times",
+			input: calendar(
+				"BEGIN:VTODO",
+				"DTSTAMP:20240102T030405Z",
+				"DUE;VALUE=DATE:20240301",
+				"COMPLETED:20240229",
+				"CREATED;TZID=America/New_York:20240101T090000",
+				`LAST-MODIFIED;TZID="/America/New_York":20240102T090000`,
+				"END:VTODO",
+			),
+			want: []Todo{{
+				Stamp:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Due:          time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+				Completed:    time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				Created:      time.Date(2024, 1, 1, 9, 0, 0, 0, newYork),
+				LastModified: time.Date(2024, 1, 2, 9, 0, 0, 0, newYork),
+			}},
+		},
+		{
+			name: "floating and unknown time zones",
+			input: calendar(
+				"BEGIN:VTODO",
+				"DUE:20240301T120000",
+				"CREATED;TZID=Custom Zone:20240101T090000",
+				"END:VTODO",
+			),
+			want: []Todo{{
+				Due:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+				Created: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "event with an end",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"UID:event-1",
+				"SUMMARY:Meeting",
+				"DTSTART:20240301T090000Z",
+				"DTEND:20240301T100000Z",
+				"DUE:20240401T000000Z",
+				"RRULE:FREQ=WEEKLY",
+				"END:VEVENT",
+			),
+			want: []Todo{{
+				UID:     "event-1",
+				Summary: "Meeting",
+				Due:     time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+				RRule:   "FREQ=WEEKLY",
+			}},
+		},
+		{
+			name: "event without an end",
+			input: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Holiday",
+				"DTSTART;VALUE=DATE:20240325",
+				"END:VEVENT",
+			),
+			want: []Todo{{Summary: "Holiday", Due: time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name: "nested and unknown components",
+			input: calendar(
+				"BEGIN:VTIMEZONE",
+				"TZID:Custom",
+				"BEGIN:STANDARD",
+				"DTSTART:19701025T030000",
+				"END:STANDARD",
+				"END:VTIMEZONE",
+				"BEGIN:VTODO",
+				"SUMMARY:Task",
+				"PRIORITY:5",
+				"status:in-process",
+				"X-CUSTOM;X-PARAM=\"a;b:c\":ignored",
+				"BEGIN:VALARM",
+				"SUMMARY:Alarm",
+				"END:VALARM",
+				"END:VTODO",
+				"BEGIN:VJOURNAL",
+				"SUMMARY:Journal",
+				"END:VJOURNAL",
+			),
+			want: []Todo{{Summary: "Task", Priority: 5, Status: StatusInProcess}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal, err := Decode(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Decode() returned error: %v", err)
+			}
+			if len(cal.Todos) != len(tt.want) {
+				t.Fatalf("got %d to-dos %+v, want %d", len(cal.Todos), cal.Todos, len(tt.want))
+			}
+			for i := range tt.want {
+				got, want := cal.Todos[i], tt.want[i]
+				// Times in the same zone compare equal with DeepEqual only if they were
+				// built the same way, so compare them separately.
+				for _, pair := range [][2]*time.Time{
+					{&got.Stamp, &want.Stamp},
+					{&got.Created, &want.Created},
+					{&got.LastModified, &want.LastModified},
+					{&got.Due, &want.Due},
+					{&got.Completed, &want.Completed},
+				} {
+					if !pair[0].Equal(*pair[1]) || pair[0].Location().String() != pair[1].Location().String() {
+						t.Errorf("time = %v, want %v", *pair[0], *pair[1])
+					}
+					*pair[0], *pair[1] = time.Time{}, time.Time{}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("to-do %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		line    int
+		message string
+	}{
+		{
+			name:    "empty",
+			input:   "",
+			line:    1,
+			message: "must start with BEGIN:VCALENDAR",
+		},
+		{
+			name:    "not a calendar",
+			input:   "BEGIN:VTODO\r\nEND:VTODO\r\n",
+			line:    1,
+			message: "must start with BEGIN:VCALENDAR",
+		},
+		{
+			name:    "property before the calendar",
+			input:   "VERSION:2.0\r\nBEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n",
+			line:    1,
+			message: "must start with BEGIN:VCALENDAR",
+		},
+		{
+			name:    "missing end",
+			input:   "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:a\r\n",
+			line:    3,
+			message: "missing END:VTODO",
+		},
+		{
+			name:    "mismatched end",
+			input:   calendar("BEGIN:VTODO", "END:VEVENT"),
+			line:    5,
+			message: "unexpected END:VEVENT",
+		},
+		{
+			name:    "line without a colon",
+			input:   calendar("BEGIN:VTODO", "SUMMARY", "END:VTODO"),
+			line:    5,
+			message: "must have a name followed by a colon",
+		},
+		{
+			name:    "unterminated parameter",
+			input:   calendar("BEGIN:VTODO", `DUE;TZID="Europe/Paris:20240101T090000`, "END:VTODO"),
+			line:    5,
+			message: "unterminated quoted value",
+		},
+		{
+			name:    "bad priority",
+			input:   calendar("BEGIN:VTODO", "PRIORITY:10", "END:VTODO"),
+			line:    5,
+			message: "PRIORITY: must be an integer between 0 and 9",
+		},
+		{
+			name:    "bad date",
+			input:   calendar("BEGIN:VTODO", "DUE;VALUE=DATE:2024-03-01", "END:VTODO"),
+			line:    5,
+			message: "DUE: must be a date",
+		},
+		{
+			name:    "bad date-time",
+			input:   calendar("BEGIN:VEVENT", "DTSTART:20240301T25000Z", "END:VEVENT"),
+			line:    5,
+			message: "DTSTART: must be a date-time",
+		},
+		{
+			name:    "line too long",
+			input:   calendar("BEGIN:VTODO", "SUMMARY:"+strings.Repeat("a", maxLineLength), "END:VTODO"),
+			line:    5,
+			message: "line is too long",
+		},
+		{
+			name:    "folded line too long",
+			input:   calendar("BEGIN:VTODO", "SUMMARY:a", " "+strings.Repeat("a", maxLineLength/2), " "+strings.Repeat("a", maxLineLength/2), "END:VTODO"),
+			line:    5,
+			message: "line is too long",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.input))
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Decode() error = %v, want a SyntaxError", err)
+			}
+			if syntaxErr.Line != tt.line {
+				t.Errorf("Line = %d, want %d", syntaxErr.Line, tt.line)
+			}
+			if !strings.Contains(syntaxErr.Message, tt.message) {
+				t.Errorf("Message = %q, want one containing %q", syntaxErr.Message, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,869 @@
+// Package markdown renders Markdown as HTML. It supports the parts of CommonMark which are
+// useful in task descriptions (paragraphs, headings, block quotes, lists, fenced code
+// blocks, thematic breaks, emphasis, code spans and links), along with strikethrough and
+// bare URLs from GitHub Flavored Markdown, and links to tasks written as #123.
+//
+// The HTML is safe to show in a browser. Raw HTML in the source is never passed through:
+// all of the text is escaped, the only elements in the output are the ones made by the
+// renderer, and links are only made to relative URLs and http, https and mailto URLs.
+package markdown
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Renderer renders Markdown as HTML.
+type Renderer struct {
+	// TaskURL returns the URL that a reference to a task, such as #123, links to. If it is
+	// nil, references to tasks are left as text.
+	TaskURL func(id int64) string
+}
+
+// Render returns the HTML for the Markdown in src.
+func (r Renderer) Render(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	src = strings.ReplaceAll(src, "\x00", "\uFFFD")
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	var b strings.Builder
+	r.blocks(&b, lines, false)
+	return b.String()
+}
+
+// blocks renders a sequence of lines as block elements. In a tight list the paragraphs
+// of the list items aren't wrapped in <p> elements.
+func (r Renderer) blocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRX.MatchString(line):
+			i = r.codeBlock(b, lines, i)
+		case isThematicBreak(line):
+			b.WriteString("<hr />\n")
+			i++
+		case isHeading(line):
+			level, text := parseHeading(line)
+			tag := "h" + strconv.Itoa(level)
+			b.WriteString("<" + tag + ">" + r.inline(text) + "</" + tag + ">\n")
+			i++
+		case isBlockquote(line):
+			i = r.blockquote(b, lines, i)
+		case isListItem(line):
+			i = r.list(b, lines, i)
+		default:
+			i = r.paragraph(b, lines, i, tight)
+		}
+	}
+}
+
+// fenceRX matches the opening line of a fenced code block, capturing its indentation,
+// the fence and the info string after it.
+var fenceRX = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+
+// codeBlock renders the fenced code block starting at lines[i], returning the index of the
+// line after it. A block which is never closed runs to the end of the document.
+func (r Renderer) codeBlock(b *strings.Builder, lines []string, i int) int {
+	m := fenceRX.FindStringSubmatch(lines[i])
+	indent, fence, info := len(m[1]), m[2], strings.TrimSpace(m[3])
+	b.WriteString("<pre><code")
+	if info != "" {
+		language := strings.Fields(info)[0]
+		b.WriteString(` class="language-` + escape(language) + `"`)
+	}
+	b.WriteString(">")
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		if isClosingFence(line, fence) {
+			i++
+			break
+		}
+		// Remove as much of the indentation of the opening fence as the line has.
+		n := 0
+		for n < indent && n < len(line) && line[n] == ' ' {
+			n++
+		}
+		b.WriteString(escape(line[n:]) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+// isClosingFence reports whether the line closes a code block opened by the fence, which
+// it does with a run of at least as many of the same characters and nothing else.
+func isClosingFence(line, fence string) bool {
+	if indentation(line) > 3 {
+		return false
+	}
+	t := strings.TrimLeft(line, " ")
+	run := len(t) - len(strings.TrimLeft(t, fence[:1]))
+	return run >= len(fence) && isBlank(t[run:])
+}
+
+// isThematicBreak reports whether the line is a thematic break, which is three or more of
+// the same one of -, * and _, optionally separated by spaces.
+func isThematicBreak(line string) bool {
+	if indentation(line) > 3 {
+		return false
+	}
+	var c byte
+	n := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+		case '-', '*', '_':
+			if c != 0 && line[i] != c {
+				return false
+			}
+			c = line[i]
+			n++
+		default:
+			return false
+		}
+	}
+	return n >= 3
+}
+
+// isHeading reports whether the line is an ATX heading, such as "## Notes". The # signs
+// must be followed by a space or the end of the line, so "#123" isn't a heading.
+func isHeading(line string) bool {
+	if indentation(line) > 3 {
+		return false
+	}
+	t := strings.TrimLeft(line, " ")
+	n := len(t) - len(strings.TrimLeft(t, "#"))
+	return n >= 1 && n <= 6 && (len(t) == n || t[n] == ' ')
+}
+
+// parseHeading returns the level and the text of an ATX heading, without any closing #
+// signs.
+func parseHeading(line string) (int, string) {
+	t := strings.TrimLeft(line, " ")
+	n := len(t) - len(strings.TrimLeft(t, "#"))
+	text := strings.TrimSpace(t[n:])
+	if trimmed := strings.TrimRight(text, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		text = strings.TrimSpace(trimmed)
+	}
+	return n, text
+}
+
+func isBlockquote(line string) bool {
+	return indentation(line) <= 3 && strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// blockquote renders the block quote starting at lines[i], returning the index of the
+// line after it. A line without a > continues the quote if it continues a paragraph.
+func (r Renderer) blockquote(b *strings.Builder, lines []string, i int) int {
+	var inner []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if !isBlockquote(line) {
+			if isBlank(line) || len(inner) == 0 || isBlank(inner[len(inner)-1]) || startsBlock(line) {
+				break
+			}
+			inner = append(inner, line)
+			continue
+		}
+		t := strings.TrimLeft(line, " ")[1:]
+		inner = append(inner, strings.TrimPrefix(t, " "))
+	}
+	b.WriteString("<blockquote>\n")
+	r.blocks(b, inner, false)
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+// listItem describes the marker at the start of a list item.
+type listItem struct {
+	ordered bool
+	// delim is the bullet character of an unordered list, or the character after the
+	// number of an ordered list.
+	delim byte
+	start int
+	// indent is the column that the content of the item starts at. Lines which are
+	// indented at least this far belong to the item.
+	indent int
+	empty  bool
+}
+
+// parseListItem reads the list marker at the start of the line, returning the marker and
+// the content of the line after it.
+func parseListItem(line string) (listItem, string, bool) {
+	var item listItem
+	spaces := indentation(line)
+	if spaces > 3 {
+		return item, "", false
+	}
+	t := line[spaces:]
+	width := 0
+	switch {
+	case t != "" && strings.IndexByte("-*+", t[0]) >= 0:
+		item.delim = t[0]
+		width = 1
+	default:
+		digits := len(t) - len(strings.TrimLeft(t, "0123456789"))
+		if digits < 1 || digits > 9 || len(t) == digits || (t[digits] != '.' && t[digits] != ')') {
+			return item, "", false
+		}
+		item.ordered = true
+		item.start, _ = strconv.Atoi(t[:digits])
+		item.delim = t[digits]
+		width = digits + 1
+	}
+	rest := t[width:]
+	if isBlank(rest) {
+		item.indent = spaces + width + 1
+		item.empty = true
+		return item, "", true
+	}
+	if rest[0] != ' ' {
+		return item, "", false
+	}
+	n := indentation(rest)
+	// Content indented by more than four spaces would start an indented code block,
+	// which we don't support, so only the first space is taken as part of the marker.
+	if n > 4 {
+		n = 1
+	}
+	item.indent = spaces + width + n
+	return item, rest[n:], true
+}
+
+func isListItem(line string) bool {
+	_, _, ok := parseListItem(line)
+	return ok
+}
+
+// list renders the list starting at lines[i], returning the index of the line after it.
+// The list is loose, and its items are wrapped in paragraphs, if any of its items are
+// separated by blank lines or hold blank lines themselves.
+func (r Renderer) list(b *strings.Builder, lines []string, i int) int {
+	first, _, _ := parseListItem(lines[i])
+	var (
+		items [][]string
+		loose bool
+	)
+	for i < len(lines) {
+		marker, content, ok := parseListItem(lines[i])
+		if !ok || marker.ordered != first.ordered || marker.delim != first.delim || isThematicBreak(lines[i]) {
+			break
+		}
+		item := []string{content}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				// A blank line only continues the item if the next line which isn't blank
+				// is indented far enough to belong to it.
+				j := nextNonBlank(lines, i)
+				if j == len(lines) || indentation(lines[j]) < marker.indent {
+					break
+				}
+				for ; i < j; i++ {
+					item = append(item, "")
+				}
+				loose = true
+			}
+			line = lines[i]
+			if indentation(line) >= marker.indent {
+				item = append(item, line[marker.indent:])
+				continue
+			}
+			// A line which isn't indented far enough continues the last paragraph of
+			// the item, as long as it doesn't start a block or another item.
+			if !isBlank(item[len(item)-1]) && !startsBlock(line) && !isListItem(line) {
+				item = append(item, strings.TrimLeft(line, " "))
+				continue
+			}
+			break
+		}
+		items = append(items, item)
+
+		// Items separated by blank lines make the list loose.
+		if j := nextNonBlank(lines, i); j > i && j < len(lines) {
+			next, _, ok := parseListItem(lines[j])
+			if !ok || next.ordered != first.ordered || next.delim != first.delim || isThematicBreak(lines[j]) {
+				break
+			}
+			loose = true
+			i = j
+		}
+	}
+
+	switch {
+	case !first.ordered:
+		b.WriteString("<ul>\n")
+	case first.start != 1:
+		b.WriteString(`<ol start="` + strconv.Itoa(first.start) + `">` + "\n")
+	default:
+		b.WriteString("<ol>\n")
+	}
+	for _, item := range items {
+		var inner strings.Builder
+		r.blocks(&inner, item, !loose)
+		html := inner.String()
+		if !loose {
+			html = strings.TrimSuffix(html, "\n")
+		}
+		b.WriteString("<li>" + html + "</li>\n")
+	}
+	if first.ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+// nextNonBlank returns the index of the first line from lines[i] on which isn't blank, or
+// len(lines) if there isn't one.
+func nextNonBlank(lines []string, i int) int {
+	for i < len(lines) && isBlank(lines[i]) {
+		i++
+	}
+	return i
+}
+
+// paragraph renders the paragraph starting at lines[i], returning the index of the line
+// after it. A line ending in two spaces is followed by a hard line break.
+func (r Renderer) paragraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) || (len(text) > 0 && startsBlock(line)) {
+			break
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+	for j, line := range text {
+		trimmed := strings.TrimRight(line, " ")
+		if j < len(text)-1 && len(line)-len(trimmed) >= 2 {
+			// Turn the spaces into the other form of hard line break, a backslash.
+			trimmed += `\`
+		}
+		text[j] = trimmed
+	}
+	html := r.inline(strings.Join(text, "\n"))
+	if tight {
+		b.WriteString(html + "\n")
+	} else {
+		b.WriteString("<p>" + html + "</p>\n")
+	}
+	return i
+}
+
+// startsBlock reports whether the line starts a block which interrupts a paragraph. As
+// in CommonMark, an ordered list only does so if it starts at 1, and a list item only does
+// so if it isn't empty.
+func startsBlock(line string) bool {
+	if fenceRX.MatchString(line) || isThematicBreak(line) || isHeading(line) || isBlockquote(line) {
+		return true
+	}
+	item, _, ok := parseListItem(line)
+	return ok && !item.empty && (!item.ordered || item.start == 1)
+}
+
+// inline renders the inline content of a block.
+func (r Renderer) inline(s string) string {
+	return newInlineParser(r, s).render(0, len(s), false)
+}
+
+// maxLinkTarget is the most bytes that the destination and title of a link can take up,
+// between the parentheses.
+const maxLinkTarget = 2048
+
+// inlineParser renders the inline content of a block. The brackets which close links and
+// the delimiters which close emphasis are found for the whole block before any of it is
+// rendered, rather than by scanning ahead from each opener, so that text with many
+// openers which are never closed still takes time in proportion to its length.
+type inlineParser struct {
+	r Renderer
+	s string
+	// runs holds the positions of the runs of backticks in s, by their length.
+	runs map[int][]int
+	// inert marks the characters which can't open or close anything: escaped characters
+	// and the characters of code spans and of runs of backticks.
+	inert []bool
+	// brackets holds the position of the ] which closes each [, or -1.
+	brackets []int
+	// closers holds, for each emphasis delimiter, the position of the first delimiter
+	// from each position on which can close it, or -1. Each delimiter's closers are found
+	// the first time they're needed.
+	closers map[string][]int
+}
+
+func newInlineParser(r Renderer, s string) *inlineParser {
+	p := &inlineParser{
+		r:        r,
+		s:        s,
+		runs:     make(map[int][]int),
+		inert:    make([]bool, len(s)),
+		brackets: make([]int, len(s)),
+		closers:  make(map[string][]int),
+	}
+	for i := 0; i < len(s); {
+		n := backticks(s[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+		p.runs[n] = append(p.runs[n], i)
+		i += n
+	}
+
+	// Go through the text in the same order as render(), skipping escaped characters and
+	// code spans, and match the brackets up.
+	var open []int
+	for i := 0; i < len(s); {
+		p.brackets[i] = -1
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			p.brackets[i+1] = -1
+			p.inert[i+1] = true
+			i += 2
+		case s[i] == '`':
+			n := backticks(s[i:])
+			end := i + n
+			if k := p.codeCloser(i, n); k >= 0 {
+				end = k + n
+			}
+			for ; i < end; i++ {
+				p.brackets[i] = -1
+				p.inert[i] = true
+			}
+		case s[i] == '[':
+			open = append(open, i)
+			i++
+		case s[i] == ']':
+			if len(open) > 0 {
+				p.brackets[open[len(open)-1]] = i
+				open = open[:len(open)-1]
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return p
+}
+
+// render renders s[start:end]. Inside the text of a link, no other links are made.
+func (p *inlineParser) render(start, end int, inLink bool) string {
+	s := p.s[:end]
+	var b strings.Builder
+	for i := start; i < end; {
+		var prev byte
+		if i > start {
+			prev = s[i-1]
+		}
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			b.WriteString("<br />\n")
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(escape(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '`':
+			n := backticks(s[i:])
+			if k := p.codeCloser(i, n); k >= 0 && k+n <= end {
+				b.WriteString(codeSpan(s[i+n : k]))
+				i = k + n
+				continue
+			}
+			// A run of backticks which isn't closed is left as it is.
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		case c == '<' && !inLink:
+			if html, n, ok := autolink(s[i:]); ok {
+				b.WriteString(html)
+				i += n
+				continue
+			}
+		case c == '[' && !inLink:
+			if html, n, ok := p.link(i, end); ok {
+				b.WriteString(html)
+				i += n
+				continue
+			}
+		case c == '*' || c == '_' || c == '~':
+			if html, n, ok := p.emphasis(i, end, prev, inLink); ok {
+				b.WriteString(html)
+				i += n
+				continue
+			}
+		case c == '#' && !inLink && p.r.TaskURL != nil && !isWordChar(prev) && prev != '&':
+			if html, n, ok := p.r.taskLink(s[i:]); ok {
+				b.WriteString(html)
+				i += n
+				continue
+			}
+		case (c == 'h' || c == 'H') && !inLink && !isWordChar(prev):
+			if html, n, ok := bareURL(s[i:]); ok {
+				b.WriteString(html)
+				i += n
+				continue
+			}
+		}
+		b.WriteString(escape(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// backticks returns the number of backticks at the start of s.
+func backticks(s string) int {
+	return len(s) - len(strings.TrimLeft(s, "`"))
+}
+
+// codeCloser returns the position of the run of backticks which closes a code span opened
+// by the n backticks at s[i], which is the next run of the same number of backticks, or -1
+// if there isn't one.
+func (p *inlineParser) codeCloser(i, n int) int {
+	runs := p.runs[n]
+	if k := sort.SearchInts(runs, i+n); k < len(runs) {
+		return runs[k]
+	}
+	return -1
+}
+
+// codeSpan renders the code between the backticks of a code span.
+func codeSpan(code string) string {
+	code = strings.ReplaceAll(code, "\n", " ")
+	if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+		code = code[1 : len(code)-1]
+	}
+	return "<code>" + escape(code) + "</code>"
+}
+
+var (
+	autolinkRX = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.\-]{1,31}:[^\s<>]*)>`)
+	emailRX    = regexp.MustCompile(`^<([A-Za-z0-9.!#$%&'*+/=?^_{|}~\-]+@[A-Za-z0-9](?:[A-Za-z0-9\-]{0,61}[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9\-]{0,61}[A-Za-z0-9])?)*)>`)
+)
+
+// autolink renders an autolink such as <https://example.com> or <ann@example.com>.
+func autolink(s string) (string, int, bool) {
+	if m := autolinkRX.FindStringSubmatch(s); m != nil && safeURL(m[1]) {
+		return anchor(m[1], "", escape(m[1])), len(m[0]), true
+	}
+	if m := emailRX.FindStringSubmatch(s); m != nil {
+		return anchor("mailto:"+m[1], "", escape(m[1])), len(m[0]), true
+	}
+	return "", 0, false
+}
+
+// link renders an inline link such as [the docs](https://example.com "Title") which
+// starts at s[i] and ends before s[limit], returning the number of bytes it took up. If
+// the URL isn't safe, only the text of the link is rendered.
+func (p *inlineParser) link(i, limit int) (string, int, bool) {
+	s := p.s[:limit]
+	end := p.brackets[i]
+	if end < 0 || end+1 >= len(s) || s[end+1] != '(' {
+		return "", 0, false
+	}
+	// The destination and title have to be looked for each time, so they're only looked
+	// for a short way ahead.
+	s = s[:min(len(s), end+2+maxLinkTarget)]
+
+	j := skipSpaces(s, end+2)
+	var dest string
+	if j < len(s) && s[j] == '<' {
+		k := strings.IndexAny(s[j+1:], ">\n")
+		if k < 0 || s[j+1+k] != '>' {
+			return "", 0, false
+		}
+		dest = s[j+1 : j+1+k]
+		j += k + 2
+	} else {
+		start, parens := j, 0
+	loop:
+		for ; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case ' ', '\n', '\t':
+				break loop
+			case '(':
+				parens++
+			case ')':
+				if parens == 0 {
+					break loop
+				}
+				parens--
+			}
+		}
+		if j > len(s) {
+			j = len(s)
+		}
+		dest = s[start:j]
+	}
+
+	var title string
+	j = skipSpaces(s, j)
+	if j < len(s) && (s[j] == '"' || s[j] == '\'' || s[j] == '(') {
+		closing := s[j]
+		if closing == '(' {
+			closing = ')'
+		}
+		k := j + 1
+		for ; k < len(s) && s[k] != closing; k++ {
+			if s[k] == '\\' {
+				k++
+			}
+		}
+		if k >= len(s) {
+			return "", 0, false
+		}
+		title = unescapePunct(s[j+1 : k])
+		j = skipSpaces(s, k+1)
+	}
+	if j >= len(s) || s[j] != ')' {
+		return "", 0, false
+	}
+
+	text := p.render(i+1, end, true)
+	dest = strings.ReplaceAll(unescapePunct(dest), " ", "%20")
+	if !safeURL(dest) {
+		return text, j + 1 - i, true
+	}
+	return anchor(dest, title, text), j + 1 - i, true
+}
+
+// emphasis renders emphasis (*text* or _text_), strong emphasis (**text** or __text__)
+// or strikethrough (~~text~~) which starts at s[i] and ends before s[limit], returning
+// the number of bytes it took up. prev is the character before s[i], as underscores
+// inside words, as in snake_case, don't start emphasis.
+func (p *inlineParser) emphasis(i, limit int, prev byte, inLink bool) (string, int, bool) {
+	s := p.s[i:limit]
+	var delim, tag string
+	switch {
+	case strings.HasPrefix(s, "**") || strings.HasPrefix(s, "__"):
+		delim, tag = s[:2], "strong"
+	case strings.HasPrefix(s, "~~"):
+		delim, tag = s[:2], "del"
+	case s[0] == '*' || s[0] == '_':
+		delim, tag = s[:1], "em"
+	default:
+		return "", 0, false
+	}
+	d := len(delim)
+	if len(s) <= d || isSpace(s[d]) || (delim[0] == '_' && isWordChar(prev)) {
+		return "", 0, false
+	}
+	j := p.closer(delim, i+d+1)
+	if j < 0 || j+d > limit {
+		return "", 0, false
+	}
+	return "<" + tag + ">" + p.render(i+d, j, inLink) + "</" + tag + ">", j + d - i, true
+}
+
+// closer returns the position of the first delimiter from s[i] on which can close
+// emphasis opened with delim, or -1 if there isn't one.
+func (p *inlineParser) closer(delim string, i int) int {
+	next, ok := p.closers[delim]
+	if !ok {
+		next = make([]int, len(p.s)+1)
+		next[len(p.s)] = -1
+		for j := len(p.s) - 1; j >= 0; j-- {
+			next[j] = next[j+1]
+			if p.closes(delim, j) {
+				next[j] = j
+			}
+		}
+		p.closers[delim] = next
+	}
+	if i >= len(next) {
+		return -1
+	}
+	return next[i]
+}
+
+// closes reports whether the delimiter at s[j] can close emphasis opened with delim. It
+// can't follow a space, and a closing underscore can't be followed by a letter or digit.
+// A * or _ which is part of a run, such as the ones around strong emphasis nested inside
+// emphasis, doesn't close emphasis opened with a single one.
+func (p *inlineParser) closes(delim string, j int) bool {
+	s, d := p.s, len(delim)
+	if j == 0 || j+d > len(s) || s[j:j+d] != delim || p.inert[j] || p.inert[j+d-1] || isSpace(s[j-1]) {
+		return false
+	}
+	if delim[0] == '_' && j+d < len(s) && isWordChar(s[j+d]) {
+		return false
+	}
+	if d == 1 {
+		c := delim[0]
+		if (s[j-1] == c && !p.inert[j-1]) || (j+1 < len(s) && s[j+1] == c && !p.inert[j+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// taskLink renders a reference to a task, such as #123, at the start of s.
+func (r Renderer) taskLink(s string) (string, int, bool) {
+	digits := len(s[1:]) - len(strings.TrimLeft(s[1:], "0123456789"))
+	if digits == 0 || digits > 18 || (1+digits < len(s) && isWordChar(s[1+digits])) {
+		return "", 0, false
+	}
+	id, err := strconv.ParseInt(s[1:1+digits], 10, 64)
+	if err != nil || id < 1 {
+		return "", 0, false
+	}
+	return anchor(r.TaskURL(id), "", escape(s[:1+digits])), 1 + digits, true
+}
+
+// bareURL renders an http or https URL which isn't in a link, as GitHub Flavored Markdown
+// does. Punctuation at the end of the URL is taken to be part of the sentence around it.
+func bareURL(s string) (string, int, bool) {
+	lower := strings.ToLower(s[:min(len(s), 8)])
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return "", 0, false
+	}
+	end := strings.IndexAny(s, " \t\n<")
+	if end < 0 {
+		end = len(s)
+	}
+	url := s[:end]
+	// The parentheses are only counted once, as the URL might end with a lot of them.
+	opening, closing := strings.Count(url, "("), strings.Count(url, ")")
+	for len(url) > 0 {
+		last := url[len(url)-1]
+		if strings.IndexByte("?!.,:*_~'\"", last) >= 0 || (last == ')' && opening < closing) {
+			if last == ')' {
+				closing--
+			}
+			url = url[:len(url)-1]
+			continue
+		}
+		break
+	}
+	if i := strings.Index(url, "://"); len(url) <= i+3 {
+		return "", 0, false
+	}
+	return anchor(url, "", escape(url)), len(url), true
+}
+
+// anchor returns an <a> element linking to the URL, which must already have been checked
+// by safeURL(). Links to other sites are marked as nofollow.
+func anchor(url, title, html string) string {
+	var b strings.Builder
+	b.WriteString(`<a href="` + escape(url) + `"`)
+	if title != "" {
+		b.WriteString(` title="` + escape(title) + `"`)
+	}
+	if lower := strings.ToLower(url); strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		b.WriteString(` rel="nofollow noopener noreferrer"`)
+	}
+	b.WriteString(">" + html + "</a>")
+	return b.String()
+}
+
+// safeURL reports whether a link can be made to the URL: either it is relative, or its
+// scheme is http, https or mailto. URLs with control characters or whitespace in them are
+// refused, as browsers ignore some of those in the scheme.
+func safeURL(url string) bool {
+	for i := 0; i < len(url); i++ {
+		if url[i] <= ' ' || url[i] == 0x7f {
+			return false
+		}
+	}
+	i := strings.IndexAny(url, ":/?#")
+	if i < 0 || url[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(url[:i]) {
+	case "http", "https", "mailto":
+		return true
+	default:
+		return false
+	}
+}
+
+// escape escapes the characters which are special in HTML text and attribute values.
+func escape(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&#39;")
+
+// unescapePunct removes the backslashes which escape punctuation characters.
+func unescapePunct(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// skipSpaces returns the index of the first character from s[i] on which isn't a space or
+// a line ending.
+func skipSpaces(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+// expandTabs replaces the tabs in the indentation of a line with spaces, up to the next
+// multiple of four columns.
+func expandTabs(line string) string {
+	if !strings.HasPrefix(strings.TrimLeft(line, " "), "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			b.WriteByte(' ')
+			column++
+		case '\t':
+			n := 4 - column%4
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+		default:
+			return b.String() + line[i:]
+		}
+	}
+	return b.String()
+}
+
+// indentation returns the number of spaces at the start of the line.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.Trim(line, " \t") == ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// isWordChar reports whether the character is part of a word. Bytes of multi-byte UTF-8
+// characters are treated as part of words.
+func isWordChar(c byte) bool {
+	return c >= 0x80 || c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// isPunct reports whether the character is ASCII punctuation, which can be escaped with a
+// backslash.
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
@@ -0,0 +1,168 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var renderer = Renderer{
+	TaskURL: func(id int64) string {
+		return fmt.Sprintf("/v1/tasks/%d", id)
+	},
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "emphasis",
+			src:  "*em* **strong** ~~del~~ snake_case_name",
+			want: "<p><em>em</em> <strong>strong</strong> <del>del</del> snake_case_name</p>\n",
+		},
+		{
+			name: "nested emphasis",
+			src:  "*a **b** c*",
+			want: "<p><em>a <strong>b</strong> c</em></p>\n",
+		},
+		{
+			name: "code span",
+			src:  "`a *b* <c>`",
+			want: "<p><code>a *b* &lt;c&gt;</code></p>\n",
+		},
+		{
+			name: "code span inside emphasis",
+			src:  "*a `b*` c*",
+			want: "<p><em>a <code>b*</code> c</em></p>\n",
+		},
+		{
+			name: "link",
+			src:  `[the docs](https://example.com "Title")`,
+			want: `<p><a href="https://example.com" title="Title" rel="nofollow noopener noreferrer">the docs</a></p>` + "\n",
+		},
+		{
+			name: "relative link",
+			src:  "[notes](/notes)",
+			want: `<p><a href="/notes">notes</a></p>` + "\n",
+		},
+		{
+			name: "javascript link",
+			src:  "[click](javascript:alert(1))",
+			want: "<p>click</p>\n",
+		},
+		{
+			name: "javascript link with upper case scheme",
+			src:  "[click](JavaScript:alert(1))",
+			want: "<p>click</p>\n",
+		},
+		{
+			name: "javascript link with escaped characters",
+			src:  `[click](java\script:alert(1))`,
+			want: "<p>click</p>\n",
+		},
+		{
+			name: "javascript link with a tab in the scheme",
+			src:  "[click](<java\tscript:alert(1)>)",
+			want: "<p>click</p>\n",
+		},
+		{
+			name: "javascript autolink",
+			src:  "<javascript:alert(1)>",
+			want: "<p>&lt;javascript:alert(1)&gt;</p>\n",
+		},
+		{
+			name: "data link",
+			src:  "[x](data:text/html;base64,PHNjcmlwdD4=)",
+			want: "<p>x</p>\n",
+		},
+		{
+			name: "raw html",
+			src:  `<script>alert("x")</script>`,
+			want: "<p>&lt;script&gt;alert(&quot;x&quot;)&lt;/script&gt;</p>\n",
+		},
+		{
+			name: "raw html block",
+			src:  "<div onclick='x()'>\n\n<img src=x onerror=alert(1)>",
+			want: "<p>&lt;div onclick=&#39;x()&#39;&gt;</p>\n<p>&lt;img src=x onerror=alert(1)&gt;</p>\n",
+		},
+		{
+			name: "quotes in the url",
+			src:  `[x](https://example.com/"onmouseover="alert(1))`,
+			want: `<p><a href="https://example.com/&quot;onmouseover=&quot;alert(1)" rel="nofollow noopener noreferrer">x</a></p>` + "\n",
+		},
+		{
+			name: "quotes in the title",
+			src:  `[x](/a 'say "hi" & <go>')`,
+			want: `<p><a href="/a" title="say &quot;hi&quot; &amp; &lt;go&gt;">x</a></p>` + "\n",
+		},
+		{
+			name: "quotes in the code block language",
+			src:  "```go\" onclick=\"x\nfmt.Println()\n```",
+			want: `<pre><code class="language-go&quot;">fmt.Println()` + "\n</code></pre>\n",
+		},
+		{
+			name: "bare url",
+			src:  "see https://example.com/a_(b).",
+			want: `<p>see <a href="https://example.com/a_(b)" rel="nofollow noopener noreferrer">https://example.com/a_(b)</a>.</p>` + "\n",
+		},
+		{
+			name: "task link",
+			src:  "blocked by #123.",
+			want: `<p>blocked by <a href="/v1/tasks/123">#123</a>.</p>` + "\n",
+		},
+		{
+			name: "task link in the text of a link",
+			src:  "[see #123](/notes)",
+			want: `<p><a href="/notes">see #123</a></p>` + "\n",
+		},
+		{
+			name: "not task links",
+			src:  "a#123 &#123; #12a #0",
+			want: "<p>a#123 &amp;#123; #12a #0</p>\n",
+		},
+		{
+			name: "heading and task link",
+			src:  "# Notes\n#123",
+			want: "<h1>Notes</h1>\n" + `<p><a href="/v1/tasks/123">#123</a></p>` + "\n",
+		},
+		{
+			name: "unclosed openers",
+			src:  "*a [b `c _d ~~e",
+			want: "<p>*a [b `c _d ~~e</p>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderer.Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderLinear checks that text full of openers which are never closed is rendered in
+// time in proportion to its length, rather than each opener being checked against the
+// rest of the text.
+func TestRenderLinear(t *testing.T) {
+	tests := []string{
+		strings.Repeat("[`", 10000),
+		strings.Repeat("*a ", 6666),
+		strings.Repeat("_a ", 6666),
+		strings.Repeat("**a ", 5000),
+		strings.Repeat("~~a ", 5000),
+		strings.Repeat("[a](", 5000),
+		strings.Repeat("`", 5000) + strings.Repeat("a`", 5000),
+		"http://example.com" + strings.Repeat(")", 20000),
+	}
+	for _, src := range tests {
+		start := time.Now()
+		renderer.Render(src)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Render(%q...) took %v", src[:8], elapsed)
+		}
+	}
+}
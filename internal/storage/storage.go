@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when an object doesn't exist in the storage backend.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage is implemented by the backends that hold the contents of uploaded files. Objects
+// are addressed by an opaque key, which is generated by NewKey() and stored alongside the
+// rest of the file's metadata in the database.
+type Storage interface {
+	// Put stores the contents of r under the key, returning the number of bytes written.
+	// If an error is returned nothing is left behind in the backend.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Open returns a reader for the object with the key, or ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object with the key. Deleting an object which doesn't exist is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewKey returns a new random key for an object.
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validKey reports whether the key looks like one generated by NewKey(), so that
+// backends can't be tricked into touching anything outside of their own space.
+func validKey(key string) bool {
+	if len(key) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
@@ -0,0 +1,21 @@
+-- user_id was created as a bigserial, so every task was handed a sequence number rather
+-- than a real owner. A sequence number which happens to match the ID of a user says
+-- nothing about who the task belongs to, so every existing task is handed to the oldest
+-- account before the column is turned into a foreign key.
+ALTER TABLE tasks ALTER COLUMN user_id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS tasks_user_id_seq;
+
+-- With no users at all there is nobody to hand the existing tasks to. Rather than
+-- deleting them, stop here, so that a user can be created and the migration run again.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM tasks) AND NOT EXISTS (SELECT 1 FROM users) THEN
+        RAISE EXCEPTION 'there are tasks but no users to own them: create a user, then run this migration again';
+    END IF;
+END
+$$;
+
+UPDATE tasks SET user_id = (SELECT min(id) FROM users);
+
+ALTER TABLE tasks ADD CONSTRAINT tasks_user_id_fkey FOREIGN KEY (user_id) REFERENCES users ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS tasks_user_id_idx ON tasks (user_id);
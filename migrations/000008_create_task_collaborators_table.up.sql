@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS task_collaborators (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (task_id, user_id),
+    CONSTRAINT task_collaborators_role_check CHECK (role IN ('viewer', 'editor', 'owner'))
+);
+CREATE INDEX IF NOT EXISTS task_collaborators_user_id_idx ON task_collaborators (user_id);
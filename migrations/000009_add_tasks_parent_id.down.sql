@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tasks_parent_id_idx;
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_parent_id_check;
+ALTER TABLE tasks DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,3 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES tasks ON DELETE CASCADE;
+ALTER TABLE tasks ADD CONSTRAINT tasks_parent_id_check CHECK (parent_id <> id);
+CREATE INDEX IF NOT EXISTS tasks_parent_id_idx ON tasks (parent_id);
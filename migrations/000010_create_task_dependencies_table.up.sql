@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    blocked_by_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (task_id, blocked_by_id),
+    CONSTRAINT task_dependencies_self_check CHECK (task_id <> blocked_by_id)
+);
+CREATE INDEX IF NOT EXISTS task_dependencies_blocked_by_id_idx ON task_dependencies (blocked_by_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS task_reminders;
+ALTER TABLE tasks DROP COLUMN IF EXISTS reminder_offsets;
@@ -0,0 +1,13 @@
+-- Reminder offsets are stored in minutes before the due date. Tasks with no offsets of
+-- their own are reminded using the server's default window.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS reminder_offsets integer[] NOT NULL DEFAULT '{}';
+
+-- Each reminder that has been sent is recorded against the due date it was sent for, so
+-- that it isn't sent again after a restart but is re-armed if the due date moves.
+CREATE TABLE IF NOT EXISTS task_reminders (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    offset_minutes integer NOT NULL,
+    due_date timestamp(0) with time zone NOT NULL,
+    sent_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (task_id, offset_minutes, due_date)
+);
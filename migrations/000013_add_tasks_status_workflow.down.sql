@@ -0,0 +1,3 @@
+ALTER TABLE tasks DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE tasks DROP COLUMN IF EXISTS started_at;
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_status_check;
@@ -0,0 +1,12 @@
+-- Map the free-text statuses that were accepted so far onto the states of the workflow,
+-- so that the new constraint can be added.
+UPDATE tasks SET status = CASE
+    WHEN lower(status) IN ('completed', 'complete', 'done', 'closed', 'finished') THEN 'completed'
+    WHEN lower(status) IN ('in-progress', 'in progress', 'in_progress', 'doing', 'started') THEN 'in-progress'
+    ELSE 'to-do'
+END
+WHERE status NOT IN ('to-do', 'in-progress', 'completed');
+
+ALTER TABLE tasks ADD CONSTRAINT tasks_status_check CHECK (status IN ('to-do', 'in-progress', 'completed'));
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS started_at timestamp(0) with time zone;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed_at timestamp(0) with time zone;
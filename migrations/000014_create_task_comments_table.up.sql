@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS task_comments (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    parent_id bigint REFERENCES task_comments ON DELETE CASCADE,
+    body text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS task_comments_task_id_idx ON task_comments (task_id);
+CREATE INDEX IF NOT EXISTS task_comments_parent_id_idx ON task_comments (parent_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS task_attachments (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL CHECK (size >= 0),
+    sha256 text NOT NULL,
+    storage_key text NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS task_attachments_task_id_idx ON task_attachments (task_id);
+CREATE INDEX IF NOT EXISTS task_attachments_user_id_idx ON task_attachments (user_id);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS task_tags (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE,
+    PRIMARY KEY (task_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS task_tags_tag_id_idx ON task_tags (tag_id);
+
+-- Carry the existing categories over as the first tag on each task.
+INSERT INTO tags (name)
+SELECT DISTINCT lower(trim(category)) FROM tasks WHERE trim(category) <> ''
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO task_tags (task_id, tag_id)
+SELECT tasks.id, tags.id FROM tasks
+INNER JOIN tags ON tags.name = lower(trim(tasks.category))
+ON CONFLICT DO NOTHING;
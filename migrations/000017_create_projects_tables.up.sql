@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS projects (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    archived boolean NOT NULL DEFAULT false,
+    settings jsonb NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS projects_user_id_idx ON projects (user_id);
+
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id bigint NOT NULL REFERENCES projects ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (project_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS project_members_user_id_idx ON project_members (user_id);
+
+-- Deleting a project leaves its tasks in place, outside of any project.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS project_id bigint REFERENCES projects ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS tasks_project_id_idx ON tasks (project_id);
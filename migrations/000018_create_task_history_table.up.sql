@@ -0,0 +1,11 @@
+-- The history of a task outlives the task itself, so task_id deliberately has no foreign key.
+CREATE TABLE IF NOT EXISTS task_history (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    task_id bigint NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    action text NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    version integer NOT NULL,
+    changes jsonb NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS task_history_task_id_idx ON task_history (task_id);
@@ -0,0 +1,9 @@
+DELETE FROM task_history WHERE action = 'restore';
+ALTER TABLE task_history DROP CONSTRAINT IF EXISTS task_history_action_check;
+ALTER TABLE task_history ADD CONSTRAINT task_history_action_check
+    CHECK (action IN ('create', 'update', 'delete'));
+
+DELETE FROM tasks WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS tasks_deleted_at_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS deleted_with;
+ALTER TABLE tasks DROP COLUMN IF EXISTS deleted_at;
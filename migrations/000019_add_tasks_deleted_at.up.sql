@@ -0,0 +1,10 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+-- deleted_with is the ID of the task whose deletion put the task in the trash, which is
+-- the task itself unless it went along with its parent. Restoring a task brings back the
+-- subtasks which went with it, and not those which were trashed on their own before.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deleted_with bigint;
+CREATE INDEX IF NOT EXISTS tasks_deleted_at_idx ON tasks (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE task_history DROP CONSTRAINT IF EXISTS task_history_action_check;
+ALTER TABLE task_history ADD CONSTRAINT task_history_action_check
+    CHECK (action IN ('create', 'update', 'delete', 'restore'));
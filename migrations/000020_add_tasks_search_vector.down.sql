@@ -0,0 +1,6 @@
+CREATE INDEX IF NOT EXISTS tasks_title_idx ON tasks USING GIN (to_tsvector('simple', title));
+
+DROP INDEX IF EXISTS tasks_search_vector_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE tasks DROP COLUMN IF EXISTS language;
+ALTER TABLE users DROP COLUMN IF EXISTS language;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language text NOT NULL DEFAULT 'simple';
+
+-- The language of a task is the one its owner had chosen when it was created, and decides
+-- how the words in it are stemmed for full-text search.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS language regconfig NOT NULL DEFAULT 'simple';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector(language, title), 'A') || setweight(to_tsvector(language, description), 'B')
+) STORED;
+CREATE INDEX IF NOT EXISTS tasks_search_vector_idx ON tasks USING GIN (search_vector);
+
+DROP INDEX IF EXISTS tasks_title_idx;
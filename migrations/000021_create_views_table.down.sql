@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS view_shares;
+DROP TABLE IF EXISTS views;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS views (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    filters jsonb NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS views_user_id_idx ON views (user_id);
+
+-- Views are only ever shared read-only, so unlike project members there is no role.
+CREATE TABLE IF NOT EXISTS view_shares (
+    view_id bigint NOT NULL REFERENCES views ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (view_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS view_shares_user_id_idx ON view_shares (user_id);
@@ -0,0 +1,7 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+-- Existing tasks were last changed when the latest entry in their history was recorded.
+UPDATE tasks SET updated_at = COALESCE(
+    (SELECT max(task_history.created_at) FROM task_history WHERE task_history.task_id = tasks.id),
+    tasks.created_at
+);
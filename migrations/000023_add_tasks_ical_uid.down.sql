@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tasks_ical_uid_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS ical_uid;
@@ -0,0 +1,7 @@
+-- The UID of the iCalendar to-do that a task was imported from, so that importing the
+-- same to-do again updates the task rather than creating another one. The index is unique
+-- so that two imports of the same to-do running at once can't both create a task for it.
+-- Tasks in the trash are left out, so that the to-do can be imported again after its task
+-- has been deleted.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS ical_uid text;
+CREATE UNIQUE INDEX IF NOT EXISTS tasks_ical_uid_idx ON tasks (user_id, ical_uid) WHERE ical_uid IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS time_entries (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    started_at timestamp(0) with time zone NOT NULL,
+    stopped_at timestamp(0) with time zone,
+    note text NOT NULL DEFAULT '',
+    CONSTRAINT time_entries_stopped_at_check CHECK (stopped_at IS NULL OR stopped_at >= started_at)
+);
+CREATE INDEX IF NOT EXISTS time_entries_task_id_idx ON time_entries (task_id);
+CREATE INDEX IF NOT EXISTS time_entries_started_at_idx ON time_entries (started_at);
+-- A timer is an entry which hasn't been stopped yet, and each user can only have one.
+CREATE UNIQUE INDEX IF NOT EXISTS time_entries_running_idx ON time_entries (user_id) WHERE stopped_at IS NULL;